@@ -0,0 +1,294 @@
+package httpapi
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	healthPath = "%s/healthz"
+
+	// ringReplicas is how many points each endpoint has on the consistent hash ring. More points
+	// spread numbers more evenly between endpoints.
+	ringReplicas = 100
+)
+
+// BalanceStrategy chooses which endpoint each call goes to.
+type BalanceStrategy int
+
+const (
+	// RoundRobin sends calls to each endpoint in turn.
+	RoundRobin BalanceStrategy = iota
+	// LeastOutstanding sends calls to the endpoint with the fewest calls in flight.
+	LeastOutstanding
+	// ConsistentHash sends calls for the same number to the same endpoint, so that each
+	// endpoint's caches see a share of the numbers rather than all of them.
+	ConsistentHash
+)
+
+// String implements the fmt.Stringer interface.
+func (s BalanceStrategy) String() string {
+	switch s {
+	case RoundRobin:
+		return "round-robin"
+	case LeastOutstanding:
+		return "least-outstanding"
+	case ConsistentHash:
+		return "consistent-hash"
+	default:
+		return fmt.Sprintf("BalanceStrategy(%d)", int(s))
+	}
+}
+
+// BalancePolicy configures how calls are spread across endpoints.
+//
+// An endpoint is taken out of use for EjectionTime after FailureThreshold calls in a row to it
+// fail because of the server or the connection to it. If HealthCheckInterval isn't zero, every
+// endpoint's /healthz is also checked that often, and endpoints which fail the check aren't used
+// until they pass. When a call to an endpoint fails it's tried at once on the next endpoint.
+// If every endpoint is out of use, they're all tried anyway.
+type BalancePolicy struct {
+	Strategy            BalanceStrategy
+	FailureThreshold    int
+	EjectionTime        time.Duration
+	HealthCheckInterval time.Duration
+}
+
+// DefaultBalancePolicy returns a round-robin policy without health checks.
+func DefaultBalancePolicy() BalancePolicy {
+	return BalancePolicy{
+		Strategy:         RoundRobin,
+		FailureThreshold: 3,
+		EjectionTime:     10 * time.Second,
+	}
+}
+
+// WithEndpoints makes the API spread calls across several replicas of a remote divide service,
+// instead of starting an embedded server. Each URL is like those given to WithBaseURL.
+// Calls are spread according to DefaultBalancePolicy, unless WithBalancePolicy is also given.
+func WithEndpoints(urls ...string) Option {
+	return func(api *API) {
+		api.endpointURLs = append(api.endpointURLs, urls...)
+	}
+}
+
+// WithBalancePolicy sets how calls are spread across the endpoints given to WithEndpoints.
+func WithBalancePolicy(policy BalancePolicy) Option {
+	return func(api *API) {
+		api.balancePolicy = &policy
+	}
+}
+
+// EndpointStatus describes an endpoint the API calls.
+type EndpointStatus struct {
+	URL         string
+	Healthy     bool  // Whether the endpoint is in use.
+	Outstanding int64 // Calls in flight.
+	Failures    int64 // Failed calls since the API was created.
+}
+
+// endpoint is a replica of the divide service.
+type endpoint struct {
+	url         string
+	outstanding atomic.Int64
+	failures    atomic.Int64
+
+	mu           sync.Mutex
+	consecutive  int       // Failures in a row.
+	ejectedUntil time.Time // When a passively ejected endpoint can be used again.
+	checkFailed  bool      // Whether the last active health check failed.
+}
+
+// ringPoint is an endpoint's point on the consistent hash ring.
+type ringPoint struct {
+	hash     uint64
+	endpoint *endpoint
+}
+
+// balancer spreads calls across endpoints.
+type balancer struct {
+	policy    BalancePolicy
+	endpoints []*endpoint
+	ring      []ringPoint // Sorted by hash.
+	next      atomic.Uint64
+	now       func() time.Time
+}
+
+func newBalancer(policy BalancePolicy, urls []string) *balancer {
+	b := &balancer{policy: policy, now: time.Now}
+	for _, url := range urls {
+		e := &endpoint{url: url}
+		b.endpoints = append(b.endpoints, e)
+		for i := range ringReplicas {
+			b.ring = append(b.ring, ringPoint{hash: hashKey(url + "#" + strconv.Itoa(i)), endpoint: e})
+		}
+	}
+	slices.SortFunc(b.ring, func(x, y ringPoint) int { return cmp.Compare(x.hash, y.hash) })
+	return b
+}
+
+// hashKey places a key on the consistent hash ring.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// FNV hashes of short keys such as small numbers differ in few bits, which would bunch them
+	// together on the ring, so the bits are mixed with MurmurHash3's finalizer.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// healthy reports whether an endpoint is in use.
+func (b *balancer) healthy(e *endpoint) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !e.checkFailed && !b.now().Before(e.ejectedUntil)
+}
+
+// order returns the endpoints to try for a call, best first. key is used by ConsistentHash.
+// Endpoints out of use are left out, unless they all are.
+func (b *balancer) order(key string) []*endpoint {
+	var candidates []*endpoint
+	switch b.policy.Strategy {
+	case ConsistentHash:
+		candidates = b.ringOrder(key)
+	case LeastOutstanding:
+		// Rotating first means endpoints with the same number of calls take turns.
+		candidates = b.rotated()
+		slices.SortStableFunc(candidates, func(x, y *endpoint) int {
+			return cmp.Compare(x.outstanding.Load(), y.outstanding.Load())
+		})
+	default:
+		candidates = b.rotated()
+	}
+
+	healthy := slices.DeleteFunc(slices.Clone(candidates), func(e *endpoint) bool { return !b.healthy(e) })
+	if len(healthy) == 0 {
+		return candidates
+	}
+	return healthy
+}
+
+// rotated returns the endpoints starting from the next in turn.
+func (b *balancer) rotated() []*endpoint {
+	start := int(b.next.Add(1)-1) % len(b.endpoints)
+	return append(slices.Clone(b.endpoints[start:]), b.endpoints[:start]...)
+}
+
+// ringOrder returns the endpoints in the order they follow the key on the consistent hash ring.
+func (b *balancer) ringOrder(key string) []*endpoint {
+	hash := hashKey(key)
+	i, _ := slices.BinarySearchFunc(b.ring, hash, func(p ringPoint, hash uint64) int { return cmp.Compare(p.hash, hash) })
+
+	order := make([]*endpoint, 0, len(b.endpoints))
+	for j := 0; j < len(b.ring) && len(order) < len(b.endpoints); j++ {
+		e := b.ring[(i+j)%len(b.ring)].endpoint
+		if !slices.Contains(order, e) {
+			order = append(order, e)
+		}
+	}
+	return order
+}
+
+// record notes the result of a call to an endpoint, ejecting it after too many failures in a row.
+func (b *balancer) record(e *endpoint, failed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !failed {
+		e.consecutive = 0
+		return
+	}
+	e.failures.Add(1)
+	e.consecutive++
+	if b.policy.FailureThreshold > 0 && e.consecutive >= b.policy.FailureThreshold {
+		e.consecutive = 0
+		e.ejectedUntil = b.now().Add(b.policy.EjectionTime)
+		slog.Warn("Divide endpoint ejected", slog.String("endpoint", e.url), slog.Duration("for", b.policy.EjectionTime))
+	}
+}
+
+// status returns the status of every endpoint.
+func (b *balancer) status() []EndpointStatus {
+	statuses := make([]EndpointStatus, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		statuses = append(statuses, EndpointStatus{
+			URL:         e.url,
+			Healthy:     b.healthy(e),
+			Outstanding: e.outstanding.Load(),
+			Failures:    e.failures.Load(),
+		})
+	}
+	return statuses
+}
+
+// checkHealth checks every endpoint's /healthz once, with a timeout of the check interval.
+func (b *balancer) checkHealth(ctx context.Context, client *http.Client) {
+	var wg sync.WaitGroup
+	for _, e := range b.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, b.policy.HealthCheckInterval)
+			defer cancel()
+			healthy := probe(probeCtx, client, fmt.Sprintf(healthPath, e.url))
+			if ctx.Err() != nil {
+				// The API is stopping, which says nothing about the endpoint.
+				return
+			}
+
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			if e.checkFailed == healthy {
+				slog.Info("Divide endpoint health changed", slog.String("endpoint", e.url), slog.Bool("healthy", healthy))
+			}
+			e.checkFailed = !healthy
+		}()
+	}
+	wg.Wait()
+}
+
+// runHealthChecks checks every endpoint's health at the policy's interval until the context is done.
+func (b *balancer) runHealthChecks(ctx context.Context, client *http.Client) {
+	ticker := time.NewTicker(b.policy.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		b.checkHealth(ctx, client)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe reports whether a GET of url succeeds with 200 OK.
+func probe(ctx context.Context, client *http.Client, url string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,314 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// replica is a local stand-in for one replica of the divide service.
+type replica struct {
+	*httptest.Server
+	calls   atomic.Int32
+	failing atomic.Bool // Whether calls to /divide fail with 500s.
+	sick    atomic.Bool // Whether /healthz fails.
+}
+
+// newReplicas starts n replicas.
+func newReplicas(t *testing.T, n int) []*replica {
+	t.Helper()
+
+	replicas := make([]*replica, n)
+	for i := range replicas {
+		r := &replica{}
+		r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if req.URL.Path == "/healthz" {
+				if r.sick.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				return
+			}
+			r.calls.Add(1)
+			if r.failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message":"Internal server error"}`))
+				return
+			}
+			fmt.Fprintf(w, `{"remainder":%d}`, i)
+		}))
+		t.Cleanup(r.Close)
+		replicas[i] = r
+	}
+	return replicas
+}
+
+// balancedAPI returns an API spreading calls across the replicas.
+func balancedAPI(replicas []*replica, policy BalancePolicy) API {
+	urls := make([]string, len(replicas))
+	for i, r := range replicas {
+		urls[i] = r.URL
+	}
+	return API{baseURL: urls[0], endpointURLs: urls, client: &http.Client{}, balancer: newBalancer(policy, urls)}
+}
+
+func TestBalancer_RoundRobin(t *testing.T) {
+	replicas := newReplicas(t, 3)
+	api := balancedAPI(replicas, DefaultBalancePolicy())
+
+	for i := range 6 {
+		result, err := api.divide(i, 3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// Each replica answers with its own index, so the answers show where calls went.
+		if result != i%3 {
+			t.Errorf("Call %d: expected replica %d, got %d", i, i%3, result)
+		}
+	}
+	for i, r := range replicas {
+		if got := r.calls.Load(); got != 2 {
+			t.Errorf("Replica %d: expected 2 calls, got %d", i, got)
+		}
+	}
+}
+
+func TestBalancer_Failover(t *testing.T) {
+	replicas := newReplicas(t, 3)
+	replicas[1].failing.Store(true)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := balancedAPI(replicas, BalancePolicy{Strategy: RoundRobin, FailureThreshold: 2, EjectionTime: time.Minute})
+	api.balancer.now = func() time.Time { return now }
+
+	// Every call succeeds, as those to the failing replica are tried again on the next.
+	for i := range 9 {
+		if _, err := api.divide(i, 3); err != nil {
+			t.Fatalf("Call %d: unexpected error: %v", i, err)
+		}
+	}
+	// The failing replica is ejected after 2 failures, so it isn't called again.
+	if got := replicas[1].calls.Load(); got != 2 {
+		t.Errorf("Expected the failing replica to be called twice, got %d", got)
+	}
+	status := api.Endpoints()
+	if status[1].Healthy || status[1].Failures != 2 {
+		t.Errorf("Expected the failing replica to be ejected after 2 failures, got %+v", status[1])
+	}
+	if !status[0].Healthy || !status[2].Healthy {
+		t.Errorf("Expected the other replicas to be healthy, got %+v", status)
+	}
+
+	// Once the ejection is over, the replica is used again.
+	replicas[1].failing.Store(false)
+	now = now.Add(time.Minute)
+	for i := range 3 {
+		if _, err := api.divide(i, 3); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if got := replicas[1].calls.Load(); got != 3 {
+		t.Errorf("Expected the recovered replica to be called again, got %d calls", got)
+	}
+}
+
+func TestBalancer_AllFailing(t *testing.T) {
+	replicas := newReplicas(t, 2)
+	for _, r := range replicas {
+		r.failing.Store(true)
+	}
+	api := balancedAPI(replicas, BalancePolicy{FailureThreshold: 1, EjectionTime: time.Minute})
+
+	// With every replica ejected they're still tried, rather than failing without a call.
+	for range 2 {
+		if _, err := api.divide(10, 3); err == nil || err.Error() != "500 Internal Server Error: Internal server error" {
+			t.Errorf("Expected the server error, got %v", err)
+		}
+	}
+	if got := replicas[0].calls.Load() + replicas[1].calls.Load(); got != 4 {
+		t.Errorf("Expected every replica to be tried for each call, got %d calls", got)
+	}
+}
+
+func TestBalancer_ConsistentHash(t *testing.T) {
+	replicas := newReplicas(t, 3)
+	api := balancedAPI(replicas, BalancePolicy{Strategy: ConsistentHash})
+
+	used := map[int]bool{}
+	for n := range 30 {
+		first, err := api.divide(n, 3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// The same number always goes to the same replica.
+		for range 3 {
+			if again, _ := api.divide(n, 3); again != first {
+				t.Fatalf("Number %d went to replica %d, then %d", n, first, again)
+			}
+		}
+		used[first] = true
+	}
+	if len(used) != 3 {
+		t.Errorf("Expected numbers to be spread across every replica, got %v", used)
+	}
+
+	// Numbers for a failing replica move to another one.
+	replicas[0].failing.Store(true)
+	for n := range 30 {
+		if result, err := api.divide(n, 3); err != nil || result == 0 {
+			t.Errorf("Number %d: expected another replica, got %d and error %v", n, result, err)
+		}
+	}
+}
+
+func TestBalancer_LeastOutstanding(t *testing.T) {
+	release := make(chan struct{})
+	busy := newTestServer(t, holdUntil(release, divideServer(t)))
+	replicas := newReplicas(t, 1)
+
+	urls := []string{busy.URL, replicas[0].URL}
+	api := API{baseURL: urls[0], endpointURLs: urls, client: &http.Client{}, balancer: newBalancer(BalancePolicy{Strategy: LeastOutstanding}, urls)}
+
+	// Hold a call on the busy replica. Calls go to the first replica when there's a tie.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		api.divide(10, 3)
+	}()
+	waitFor(t, func() bool { return api.Endpoints()[0].Outstanding == 1 })
+
+	// Every other call goes to the idle replica.
+	for range 4 {
+		if _, err := api.divide(10, 3); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if got := replicas[0].calls.Load(); got != 4 {
+		t.Errorf("Expected 4 calls to the idle replica, got %d", got)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestNew_WithEndpoints(t *testing.T) {
+	replicas := newReplicas(t, 3)
+	replicas[2].sick.Store(true)
+
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg,
+		WithEndpoints(replicas[0].URL, replicas[1].URL+"/", replicas[2].URL),
+		WithBalancePolicy(BalancePolicy{Strategy: RoundRobin, HealthCheckInterval: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	// The health checks take the sick replica out of use without a call to it.
+	waitFor(t, func() bool { return !api.Endpoints()[2].Healthy })
+	for i := range 6 {
+		if _, err := api.divide(i, 3); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if got := replicas[2].calls.Load(); got != 0 {
+		t.Errorf("Expected no calls to the sick replica, got %d", got)
+	}
+
+	// It's used again once it passes.
+	replicas[2].sick.Store(false)
+	waitFor(t, func() bool { return api.Endpoints()[2].Healthy })
+}
+
+func TestNew_EndpointsWithCassette(t *testing.T) {
+	replicas := newReplicas(t, 2)
+	policy := BalancePolicy{Strategy: RoundRobin, HealthCheckInterval: 10 * time.Millisecond}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	// Health checks aren't recorded alongside the calls.
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg,
+		WithEndpoints(replicas[0].URL, replicas[1].URL), WithBalancePolicy(policy), WithCassette(path, RecordCassette))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if err := api.WaitReady(context.Background()); err != nil {
+		t.Fatalf("WaitReady() error: %v", err)
+	}
+	if _, err := api.divide(10, 3); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(5 * policy.HealthCheckInterval)
+	cancel()
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read cassette: %v", err)
+	}
+	if got := strings.Count(string(data), `"method"`); got != 1 || strings.Contains(string(data), "/healthz") || strings.Contains(string(data), "/readyz") {
+		t.Errorf("Expected only the call to be recorded, got %d interactions:\n%s", got, data)
+	}
+
+	// When replaying, the health checks still reach the endpoints rather than failing for want
+	// of a recording.
+	api = runAPI(t, WithEndpoints(replicas[0].URL, replicas[1].URL), WithBalancePolicy(policy), WithCassette(path, ReplayCassette))
+	time.Sleep(5 * policy.HealthCheckInterval)
+	for _, status := range api.Endpoints() {
+		if !status.Healthy {
+			t.Errorf("Expected every endpoint to be healthy, got %+v", status)
+		}
+	}
+	if err := api.WaitReady(context.Background()); err != nil {
+		t.Errorf("WaitReady() error: %v", err)
+	}
+}
+
+func TestNew_InvalidEndpoints(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		expectedError string
+	}{
+		{
+			name:          "Base URL and endpoints",
+			opts:          []Option{WithBaseURL("http://divide.example.com"), WithEndpoints("http://divide.example.com")},
+			expectedError: "a base URL cannot be combined with endpoints",
+		},
+		{
+			name:          "Invalid endpoint",
+			opts:          []Option{WithEndpoints("http://divide.example.com", "divide2")},
+			expectedError: `invalid base URL "divide2": must be an absolute http or https URL`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := New(context.Background(), &sync.WaitGroup{}, tt.opts...); err == nil || err.Error() != tt.expectedError {
+				t.Errorf("Expected error %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestBalanceStrategy_String(t *testing.T) {
+	for strategy, expected := range map[BalanceStrategy]string{
+		RoundRobin:         "round-robin",
+		LeastOutstanding:   "least-outstanding",
+		ConsistentHash:     "consistent-hash",
+		BalanceStrategy(9): "BalanceStrategy(9)",
+	} {
+		if got := strategy.String(); got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/pkg/repository"
+)
+
+// ErrCircuitOpen is returned by calls made while the circuit breaker is open. It wraps
+// repository.ErrUnavailable.
+var ErrCircuitOpen = fmt.Errorf("circuit breaker is open: %w", repository.ErrUnavailable)
+
+// BreakerPolicy configures the API's circuit breaker.
+//
+// The breaker starts closed, letting calls through. After FailureThreshold calls in a row fail
+// because of the server or the connection to it, it opens, and calls fail at once with
+// ErrCircuitOpen. After CoolDown it becomes half-open and lets one call at a time through to test
+// the server. SuccessThreshold successes in a row close it again, and a failure opens it.
+//
+// Failures are counted after any retries. Responses which can't be decoded or are too large count
+// as failures, even with a 200 status. Errors made by the caller, such as 400 Bad Request for a
+// division by zero, show the server is working and count as successes, and calls the caller gives
+// up on don't count at all.
+type BreakerPolicy struct {
+	FailureThreshold int
+	CoolDown         time.Duration
+	SuccessThreshold int
+}
+
+// DefaultBreakerPolicy returns a policy suitable for the divide server.
+func DefaultBreakerPolicy() BreakerPolicy {
+	return BreakerPolicy{
+		FailureThreshold: 5,
+		CoolDown:         5 * time.Second,
+		SuccessThreshold: 1,
+	}
+}
+
+// WithCircuitBreaker puts a circuit breaker around calls to the server, so that calls fail fast
+// while it's down. By default there's no breaker.
+func WithCircuitBreaker(policy BreakerPolicy) Option {
+	return func(api *API) {
+		api.breaker = newBreaker(policy)
+	}
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// String implements the fmt.Stringer interface.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// breaker is a circuit breaker applying a BreakerPolicy.
+type breaker struct {
+	policy BreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	count    int       // Failures in a row while closed, or successes in a row while half-open.
+	openedAt time.Time // When the breaker last opened.
+	probing  bool      // Whether a half-open call is in flight.
+}
+
+func newBreaker(policy BreakerPolicy) *breaker {
+	return &breaker{policy: policy, now: time.Now}
+}
+
+// setState changes the breaker's state, logging the change. The caller must hold the lock.
+func (b *breaker) setState(state BreakerState) {
+	if state == b.state {
+		return
+	}
+	slog.Info("Circuit breaker state changed",
+		slog.String("from", b.state.String()),
+		slog.String("to", state.String()))
+
+	b.state = state
+	b.count = 0
+	b.probing = false
+	if state == BreakerOpen {
+		b.openedAt = b.now()
+	}
+}
+
+// coolDownElapsed moves an open breaker to half-open once its cool-down is over.
+// The caller must hold the lock.
+func (b *breaker) coolDownElapsed() {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.policy.CoolDown {
+		b.setState(BreakerHalfOpen)
+	}
+}
+
+// allow returns ErrCircuitOpen if a call mustn't be made. Otherwise the caller must make the call
+// and pass its result to done.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.coolDownElapsed()
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// done records the result of a call allowed by allow. Calls cancelled by the caller aren't
+// counted either way.
+func (b *breaker) done(err error) {
+	failed := breakerFailure(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		if b.state == BreakerHalfOpen {
+			b.probing = false
+		}
+		return
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.count = 0
+			return
+		}
+		b.count++
+		if b.count >= b.policy.FailureThreshold {
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.setState(BreakerOpen)
+			return
+		}
+		b.count++
+		if b.count >= b.policy.SuccessThreshold {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// breakerFailure reports whether err shows the server, or the connection to it, is failing.
+func breakerFailure(err error) bool {
+	var (
+		apiErr       *APIError
+		decodeErr    *DecodeError
+		transportErr *TransportError
+	)
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &apiErr):
+		// 429 Too Many Requests is the server struggling rather than a mistake by the caller.
+		caller := apiErr.StatusCode >= 400 && apiErr.StatusCode <= 499 && apiErr.StatusCode != http.StatusTooManyRequests
+		return !caller
+	case errors.As(err, &decodeErr), errors.As(err, &transportErr),
+		errors.Is(err, ErrResponseTooLarge), errors.Is(err, ErrUnknownLength):
+		return true
+	default:
+		// Such as failing to build the request.
+		return false
+	}
+}
+
+// available returns ErrCircuitOpen if the breaker is open, without using up a half-open call.
+func (b *breaker) available() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.coolDownElapsed()
+	if b.state == BreakerOpen {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// currentState returns the breaker's state.
+func (b *breaker) currentState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.coolDownElapsed()
+	return b.state
+}
@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server"
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/pkg/repository"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// The server fails with 500s until it recovers.
+	var failing atomic.Bool
+	failing.Store(true)
+	healthy, serverError := divideServer(t), injectFault(t, server.Faults{ServerError: 1})
+	srv := newTestServer(t, func(call int32, w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			serverError(call, w, r)
+			return
+		}
+		healthy(call, w, r)
+	})
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBreaker(BreakerPolicy{FailureThreshold: 3, CoolDown: time.Minute, SuccessThreshold: 2})
+	b.now = func() time.Time { return now }
+	api := API{baseURL: srv.URL, client: srv.Client(), breaker: b}
+
+	expectState := func(expected BreakerState) {
+		t.Helper()
+		if got := api.BreakerState(); got != expected {
+			t.Fatalf("Expected the breaker to be %s, got %s", expected, got)
+		}
+	}
+
+	// Failures below the threshold leave the breaker closed.
+	for range 2 {
+		if _, err := api.divide(10, 3); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected a server error, got %v", err)
+		}
+	}
+	expectState(BreakerClosed)
+	if err := api.Available(); err != nil {
+		t.Errorf("Expected the API to be available, got %v", err)
+	}
+
+	// The third failure opens it, and calls then fail without reaching the server.
+	api.divide(10, 3)
+	expectState(BreakerOpen)
+	_, err := api.divide(10, 3)
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, repository.ErrUnavailable) {
+		t.Errorf("Expected ErrCircuitOpen wrapping repository.ErrUnavailable, got %v", err)
+	}
+	if !errors.Is(api.Available(), repository.ErrUnavailable) {
+		t.Errorf("Expected the API to be unavailable, got %v", api.Available())
+	}
+	if got := srv.calls.Load(); got != 3 {
+		t.Errorf("Expected 3 calls to reach the server, got %d", got)
+	}
+
+	// After the cool-down a failed trial call opens it again.
+	now = now.Add(time.Minute)
+	expectState(BreakerHalfOpen)
+	api.divide(10, 3)
+	expectState(BreakerOpen)
+
+	// Once the server recovers, enough successful trial calls close it.
+	failing.Store(false)
+	now = now.Add(time.Minute)
+	for range 2 {
+		if _, err := api.divide(10, 3); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	expectState(BreakerClosed)
+	if got := srv.calls.Load(); got != 6 {
+		t.Errorf("Expected 6 calls to reach the server, got %d", got)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenAllowsOneCall(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBreaker(BreakerPolicy{FailureThreshold: 1, CoolDown: time.Second, SuccessThreshold: 1})
+	b.now = func() time.Time { return now }
+
+	b.done(&APIError{StatusCode: http.StatusServiceUnavailable})
+	now = now.Add(time.Second)
+
+	if err := b.allow(); err != nil {
+		t.Fatalf("Expected the first half-open call to be allowed, got %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a second concurrent call to be refused, got %v", err)
+	}
+	// Checking availability doesn't use up the trial call.
+	if err := b.available(); err != nil {
+		t.Errorf("Expected a half-open breaker to be available, got %v", err)
+	}
+	b.done(nil)
+	if got := b.currentState(); got != BreakerClosed {
+		t.Errorf("Expected the breaker to be closed, got %s", got)
+	}
+}
+
+func TestCircuitBreaker_ClientErrorsDontCount(t *testing.T) {
+	srv := newTestServer(t, divideServer(t))
+
+	api := API{baseURL: srv.URL, client: srv.Client(), breaker: newBreaker(BreakerPolicy{FailureThreshold: 1, CoolDown: time.Minute})}
+	for range 3 {
+		if _, err := api.divide(10, 0); err == nil || err.Error() != "400 Bad Request: Division by zero is not allowed" {
+			t.Fatalf("Expected the division by zero error, got %v", err)
+		}
+	}
+	if got := api.BreakerState(); got != BreakerClosed {
+		t.Errorf("Expected the breaker to stay closed, got %s", got)
+	}
+}
+
+func TestCircuitBreaker_BadResponsesCount(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault server.Faults
+	}{
+		{name: "Malformed 200s", fault: server.Faults{MalformedJSON: 1}},
+		{name: "Oversized 200s", fault: server.Faults{OversizedBody: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, injectFault(t, tt.fault))
+			api := API{baseURL: srv.URL, client: srv.Client(), breaker: newBreaker(BreakerPolicy{FailureThreshold: 2, CoolDown: time.Minute})}
+
+			for range 2 {
+				if _, err := api.divide(10, 3); err == nil || errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("Expected the bad response to fail, got %v", err)
+				}
+			}
+			if got := api.BreakerState(); got != BreakerOpen {
+				t.Errorf("Expected the breaker to open, got %s", got)
+			}
+		})
+	}
+}
+
+func TestBreakerState_String(t *testing.T) {
+	for state, expected := range map[BreakerState]string{
+		BreakerClosed:   "closed",
+		BreakerOpen:     "open",
+		BreakerHalfOpen: "half-open",
+		BreakerState(9): "BreakerState(9)",
+	} {
+		if got := state.String(); got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package httpapi
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedBodySize is the largest response body the cache will store.
+const maxCachedBodySize = 64 * 1024
+
+// Cache stores responses for the API's HTTP cache. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the entry stored under key, if there is one.
+	Get(key string) ([]byte, bool)
+	// Set stores an entry under key, replacing any already there.
+	Set(key string, entry []byte)
+}
+
+// WithCache makes the API keep responses in the cache, following RFC 9111. Fresh responses are
+// served without calling the server, and stale ones with an ETag are revalidated.
+func WithCache(cache Cache) Option {
+	return func(api *API) {
+		api.cache = cache
+	}
+}
+
+// MemoryCache is a Cache which holds its entries in memory, evicting the least recently used.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List // Most recently used at the front.
+}
+
+type memoryCacheEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache returns a MemoryCache holding at most maxEntries entries.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// Get implements the Cache interface.
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*memoryCacheEntry).value, true
+}
+
+// Set implements the Cache interface.
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*memoryCacheEntry).value = value
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&memoryCacheEntry{key: key, value: value})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+}
+
+// DirCache is a Cache which keeps each entry in a file in a directory, so that entries outlive
+// the process and repeated runs can share them. Failures to read or write files are treated as
+// cache misses.
+type DirCache struct {
+	dir string
+}
+
+// NewDirCache returns a DirCache using dir, which is created if it doesn't exist.
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &DirCache{dir: dir}, nil
+}
+
+// path returns the file an entry is kept in, named by a hash of its key.
+func (c *DirCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get implements the Cache interface.
+func (c *DirCache) Get(key string) ([]byte, bool) {
+	value, err := os.ReadFile(c.path(key))
+	return value, err == nil
+}
+
+// Set implements the Cache interface. Entries are written to a temporary file and renamed into
+// place, so that concurrent readers never see part of an entry.
+func (c *DirCache) Set(key string, value []byte) {
+	f, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), c.path(key)); err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// cacheEntry is a stored response.
+type cacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	StoredAt   time.Time         // When the response was generated, allowing for any Age it arrived with.
+	Vary       map[string]string // The request's values of the headers the response varies on.
+}
+
+// matches reports whether the entry can be used for the request, according to its Vary header.
+func (e *cacheEntry) matches(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// response returns the stored response for the request.
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheControl parses a Cache-Control header into its directives, with lower case names.
+func cacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// freshnessLifetime returns how long a response is fresh for after it was generated.
+func freshnessLifetime(header http.Header) time.Duration {
+	directives := cacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return 0
+	}
+	seconds, err := strconv.ParseInt(directives["max-age"], 10, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// cachingTransport is an http.RoundTripper which implements a private RFC 9111 cache for GET
+// requests, keyed by URL.
+type cachingTransport struct {
+	next  http.RoundTripper
+	cache Cache
+	now   func() time.Time
+}
+
+func newCachingTransport(next http.RoundTripper, cache Cache) *cachingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &cachingTransport{next: next, cache: cache, now: time.Now}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+	key := req.URL.String()
+
+	var stored *cacheEntry
+	if data, ok := t.cache.Get(key); ok {
+		var entry cacheEntry
+		if err := json.Unmarshal(data, &entry); err == nil && entry.matches(req) {
+			stored = &entry
+		}
+	}
+
+	if stored != nil {
+		age := max(t.now().Sub(stored.StoredAt), 0)
+		if age < freshnessLifetime(stored.Header) {
+			resp := stored.response(req)
+			resp.Header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+			return resp, nil
+		}
+		if tag := stored.Header.Get("ETag"); tag != "" {
+			// The request is the caller's, so it's cloned before being changed.
+			req = req.Clone(req.Context())
+			req.Header.Set("If-None-Match", tag)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored != nil && resp.StatusCode == http.StatusNotModified {
+		// The stored response is still good. Its headers are updated from the 304, as it may
+		// carry a new lifetime.
+		resp.Body.Close()
+		for name, values := range resp.Header {
+			stored.Header[name] = values
+		}
+		stored.StoredAt = t.generatedAt(resp.Header)
+		t.store(key, stored)
+		return stored.response(req), nil
+	}
+
+	return t.maybeStore(key, req, resp), nil
+}
+
+// CloseIdleConnections closes any idle connections of the wrapped transport.
+func (t *cachingTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// generatedAt returns when a response just received was generated, allowing for its Age header.
+func (t *cachingTransport) generatedAt(header http.Header) time.Time {
+	age, err := strconv.ParseInt(header.Get("Age"), 10, 64)
+	if err != nil || age < 0 {
+		age = 0
+	}
+	return t.now().Add(-time.Duration(age) * time.Second)
+}
+
+// maybeStore stores the response if it's cacheable, returning a response for the caller to read
+// in place of the one passed in.
+func (t *cachingTransport) maybeStore(key string, req *http.Request, resp *http.Response) *http.Response {
+	if resp.StatusCode != http.StatusOK || resp.ContentLength > maxCachedBodySize {
+		return resp
+	}
+	if _, ok := cacheControl(resp.Header)["no-store"]; ok {
+		return resp
+	}
+	if freshnessLifetime(resp.Header) == 0 && resp.Header.Get("ETag") == "" {
+		// It could never be used without calling the server again anyway.
+		return resp
+	}
+
+	vary := map[string]string{}
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return resp
+			}
+			if name != "" {
+				vary[name] = req.Header.Get(name)
+			}
+		}
+	}
+
+	body, err := bufferBody(resp, maxCachedBodySize)
+	if err != nil {
+		return resp
+	}
+
+	entry := &cacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		StoredAt:   t.generatedAt(resp.Header),
+		Vary:       vary,
+	}
+	t.store(key, entry)
+	return entry.response(req)
+}
+
+// store saves the entry under key.
+func (t *cachingTransport) store(key string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	t.cache.Set(key, data)
+}
+
+// bufferBody reads a response body of up to limit bytes into memory, replacing the response's
+// body with a reader of the copy. If the body is larger, or can't be read, it returns an error,
+// and the response's body hands back what's been read followed by the rest, so the caller sees
+// the whole body or the same error.
+func bufferBody(resp *http.Response, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil || int64(len(body)) > limit {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), errReader{err}, resp.Body), resp.Body}
+		if err == nil {
+			err = fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, limit)
+		}
+		return nil, err
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// errReader returns its error from every read, or io.EOF if it's nil.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err == nil {
+		return 0, io.EOF
+	}
+	return 0, r.err
+}
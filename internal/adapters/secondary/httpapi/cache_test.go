@@ -0,0 +1,218 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server"
+)
+
+func TestCachingTransport(t *testing.T) {
+	tests := []struct {
+		name          string
+		cacheControl  string
+		etag          string
+		vary          string
+		secondAccept  string
+		advance       time.Duration
+		expectedCalls int32
+		expectedBody  string
+	}{
+		{name: "Fresh response is reused", cacheControl: "max-age=60", expectedCalls: 1, expectedBody: "1"},
+		{name: "Stale response without a validator is fetched again", cacheControl: "max-age=60", advance: time.Minute, expectedCalls: 2, expectedBody: "2"},
+		{name: "Stale response is revalidated", cacheControl: "max-age=60", etag: `"tag"`, advance: time.Minute, expectedCalls: 2, expectedBody: "1"},
+		{name: "No-cache is always revalidated", cacheControl: "no-cache", etag: `"tag"`, expectedCalls: 2, expectedBody: "1"},
+		{name: "No-store isn't stored", cacheControl: "no-store, max-age=60", expectedCalls: 2, expectedBody: "2"},
+		{name: "Varying header matches", cacheControl: "max-age=60", vary: "Accept", secondAccept: "application/json", expectedCalls: 1, expectedBody: "1"},
+		{name: "Varying header differs", cacheControl: "max-age=60", vary: "Accept", secondAccept: "application/xml", expectedCalls: 2, expectedBody: "2"},
+		{name: "Vary star isn't stored", cacheControl: "max-age=60", vary: "*", expectedCalls: 2, expectedBody: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				if tt.vary != "" {
+					w.Header().Set("Vary", tt.vary)
+				}
+				if tt.etag != "" {
+					w.Header().Set("ETag", tt.etag)
+					if r.Header.Get("If-None-Match") == tt.etag {
+						w.WriteHeader(http.StatusNotModified)
+						return
+					}
+				}
+				fmt.Fprint(w, n)
+			}))
+			defer mock.Close()
+
+			now := time.Unix(1700000000, 0)
+			transport := newCachingTransport(mock.Client().Transport, NewMemoryCache(10))
+			transport.now = func() time.Time { return now }
+			client := &http.Client{Transport: transport}
+
+			get := func(accept string) string {
+				req, _ := http.NewRequest(http.MethodGet, mock.URL+"/divide?a=10&b=3", nil)
+				req.Header.Set("Accept", accept)
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("Failed to make GET request: %v", err)
+				}
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+				return string(body)
+			}
+
+			get("application/json")
+			now = now.Add(tt.advance)
+			accept := tt.secondAccept
+			if accept == "" {
+				accept = "application/json"
+			}
+			if body := get(accept); body != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, body)
+			}
+			if got := calls.Load(); got != tt.expectedCalls {
+				t.Errorf("Expected %d calls to the server, got %d", tt.expectedCalls, got)
+			}
+		})
+	}
+}
+
+func TestCachingTransport_Age(t *testing.T) {
+	var calls atomic.Int32
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Age", "50") // From a shared cache along the way.
+		fmt.Fprint(w, "ok")
+	}))
+	defer mock.Close()
+
+	now := time.Unix(1700000000, 0)
+	transport := newCachingTransport(mock.Client().Transport, NewMemoryCache(10))
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+
+	get := func() *http.Response {
+		t.Helper()
+		resp, err := client.Get(mock.URL)
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	get()
+	now = now.Add(5 * time.Second)
+	if resp := get(); resp.Header.Get("Age") != "55" || calls.Load() != 1 {
+		t.Errorf("Expected a cached response with Age 55, got Age %q after %d calls", resp.Header.Get("Age"), calls.Load())
+	}
+
+	// The response arrived 50 seconds old, so it's stale 10 seconds after it was stored.
+	now = now.Add(5 * time.Second)
+	get()
+	if calls.Load() != 2 {
+		t.Errorf("Expected a stale response to be fetched again, got %d calls", calls.Load())
+	}
+}
+
+func TestCachingTransport_LargeBody(t *testing.T) {
+	body := make([]byte, maxCachedBodySize+1)
+	mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		// Flush before writing, so that there's no Content-Length to check.
+		w.WriteHeader(http.StatusOK)
+		http.NewResponseController(w).Flush()
+		w.Write(body)
+	}))
+	defer mock.Close()
+
+	cache := NewMemoryCache(10)
+	client := &http.Client{Transport: newCachingTransport(mock.Client().Transport, cache)}
+
+	resp, err := client.Get(mock.URL)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	got, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || len(got) != len(body) {
+		t.Errorf("Expected the whole %d byte body, got %d bytes and error %v", len(body), len(got), err)
+	}
+	if _, ok := cache.Get(mock.URL); ok {
+		t.Errorf("Expected a body over %d bytes not to be stored", maxCachedBodySize)
+	}
+}
+
+func TestMemoryCache_Eviction(t *testing.T) {
+	cache := NewMemoryCache(2)
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.Get("a")
+	cache.Set("c", []byte("3"))
+
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Expected entry %q to be kept", key)
+		}
+	}
+}
+
+func TestDirCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDirCache(dir)
+	if err != nil {
+		t.Fatalf("NewDirCache() error: %v", err)
+	}
+	if _, ok := cache.Get("key"); ok {
+		t.Errorf("Expected a miss from an empty cache")
+	}
+	cache.Set("key", []byte("value"))
+
+	// A new cache on the same directory, as in a later run, sees the entry.
+	again, err := NewDirCache(dir)
+	if err != nil {
+		t.Fatalf("NewDirCache() error: %v", err)
+	}
+	if value, ok := again.Get("key"); !ok || string(value) != "value" {
+		t.Errorf("Expected the stored value, got %q, %v", value, ok)
+	}
+}
+
+func TestNew_WithCache(t *testing.T) {
+	// The server only allows one request, so any more must be served from the cache.
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg,
+		WithCache(NewMemoryCache(100)),
+		WithServerOptions(server.WithRateLimit(0.001, 1)))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for range 3 {
+		if result, err := api.divide(10, 3); err != nil || result != 1 {
+			t.Fatalf("divide() = %d, %v, expected 1", result, err)
+		}
+	}
+	if _, err := api.divide(10, 4); err == nil {
+		t.Errorf("Expected an uncached request to be rate limited")
+	}
+}
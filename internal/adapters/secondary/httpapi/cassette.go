@@ -0,0 +1,234 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxRecordedBodySize is the largest response body a Cassette records. Larger responses are
+// passed on without being recorded.
+const maxRecordedBodySize = 64 * 1024
+
+// ErrNoInteraction is wrapped by errors for requests a replaying Cassette has no recording of.
+var ErrNoInteraction = errors.New("no recorded interaction")
+
+// CassetteMode says whether a Cassette records or replays.
+type CassetteMode int
+
+const (
+	// RecordCassette passes every request on and records the exchange.
+	RecordCassette CassetteMode = iota
+	// ReplayCassette answers requests from the recording, failing those it has no recording of.
+	ReplayCassette
+	// ReplayCassettePassThrough answers requests from the recording, passing those it has no
+	// recording of on.
+	ReplayCassettePassThrough
+)
+
+// WithCassette makes the API record its exchanges with the divide server to a cassette file, or
+// replay them from one. When replaying without passing requests through, and without a base URL
+// or endpoints, no server is started, so tests and bug reports can be reproduced offline.
+// Recordings are saved when the API is stopped.
+func WithCassette(path string, mode CassetteMode) Option {
+	return func(api *API) {
+		api.cassettePath = path
+		api.cassetteMode = mode
+	}
+}
+
+// interaction is a recorded exchange. Requests are matched on their method, path and query, and
+// Accept header, so recordings don't depend on the server's address, credentials or request IDs.
+type interaction struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"` // The path and query.
+		Accept string `json:"accept,omitempty"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int         `json:"status"`
+		Header     http.Header `json:"header,omitempty"`
+		Body       string      `json:"body,omitempty"`
+		BodyBase64 string      `json:"body_base64,omitempty"` // Used instead of Body for binary formats such as CBOR.
+	} `json:"response"`
+
+	used bool // Whether the interaction has been replayed.
+}
+
+// matches reports whether the interaction is a recording of the request.
+func (i *interaction) matches(req *http.Request) bool {
+	return i.Request.Method == req.Method && i.Request.URL == req.URL.RequestURI() && i.Request.Accept == req.Header.Get("Accept")
+}
+
+// cassetteFile is the JSON form of a cassette.
+type cassetteFile struct {
+	Interactions []*interaction `json:"interactions"`
+}
+
+// Cassette is an http.RoundTripper which records exchanges, or replays them from a recording.
+// Identical requests recorded more than once are replayed in the order they were recorded, then
+// the last is repeated, so sequences such as a failure followed by a successful retry replay the same.
+type Cassette struct {
+	path string
+	mode CassetteMode
+	next http.RoundTripper // Requests are passed to it when recording or passing through.
+
+	mu           sync.Mutex
+	interactions []*interaction
+}
+
+// NewCassette returns a Cassette which records to, or replays from, the file at path.
+// next is used for requests which aren't replayed, or http.DefaultTransport if it's nil.
+func NewCassette(path string, mode CassetteMode, next http.RoundTripper) (*Cassette, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c := &Cassette{path: path, mode: mode, next: next}
+	if mode == RecordCassette {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette: %w", err)
+	}
+	c.interactions = file.Interactions
+	return c, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.mode == RecordCassette {
+		return c.record(req)
+	}
+
+	if resp := c.replay(req); resp != nil {
+		return resp, nil
+	}
+	if c.mode == ReplayCassettePassThrough {
+		return c.next.RoundTrip(req)
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.RequestURI())
+}
+
+// replay returns the recorded response to the request, or nil if there isn't one.
+func (c *Cassette) replay(req *http.Request) *http.Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var last *interaction
+	for _, i := range c.interactions {
+		if !i.matches(req) {
+			continue
+		}
+		if !i.used {
+			i.used = true
+			return i.response(req)
+		}
+		last = i
+	}
+	if last != nil {
+		return last.response(req)
+	}
+	return nil
+}
+
+// response returns the recorded response for the request.
+func (i *interaction) response(req *http.Request) *http.Response {
+	body := []byte(i.Response.Body)
+	if i.Response.BodyBase64 != "" {
+		// The recording was checked when it was made, so a decoding failure means it's been
+		// edited by hand, and the body is left empty.
+		body, _ = base64.StdEncoding.DecodeString(i.Response.BodyBase64)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+		StatusCode:    i.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Response.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// record passes the request on and records the exchange.
+func (c *Cassette) record(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := bufferBody(resp, maxRecordedBodySize)
+	if err != nil {
+		// The caller still gets the response, but the exchange isn't recorded.
+		slog.Warn("Divide API response not recorded in cassette",
+			slog.String("url", req.URL.RequestURI()),
+			slog.String("error", err.Error()))
+		return resp, nil
+	}
+
+	i := &interaction{}
+	i.Request.Method = req.Method
+	i.Request.URL = req.URL.RequestURI()
+	i.Request.Accept = req.Header.Get("Accept")
+	i.Response.StatusCode = resp.StatusCode
+	i.Response.Header = resp.Header.Clone()
+	// The date and request ID would make every recording different.
+	i.Response.Header.Del("Date")
+	i.Response.Header.Del("X-Request-Id")
+	if utf8.Valid(body) {
+		i.Response.Body = string(body)
+	} else {
+		i.Response.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, i)
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// Save writes the recorded interactions to the cassette file. It does nothing when replaying.
+func (c *Cassette) Save() error {
+	if c.mode != RecordCassette {
+		return nil
+	}
+
+	// Escaping HTML would make the URLs in the file harder to read.
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	c.mu.Lock()
+	err := enc.Encode(cassetteFile{Interactions: c.interactions})
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if err := os.WriteFile(c.path, data.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// CloseIdleConnections closes any idle connections of the wrapped transport.
+func (c *Cassette) CloseIdleConnections() {
+	if closer, ok := c.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,187 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fizzBuzzCassette is a recording of Fizz and Buzz for 1 to 15 against the embedded server.
+const fizzBuzzCassette = "testdata/fizzbuzz.json"
+
+var update = flag.Bool("update", false, "record the cassettes in testdata again")
+
+// runAPI creates an API with the options, stopping it when the test ends.
+func runAPI(t *testing.T, opts ...Option) *API {
+	t.Helper()
+
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg, opts...)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	return api
+}
+
+func TestCassette_FizzBuzz(t *testing.T) {
+	if *update {
+		wg := sync.WaitGroup{}
+		api, cancel, err := New(context.Background(), &wg, WithCassette(fizzBuzzCassette, RecordCassette))
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		for in := 1; in <= 15; in++ {
+			api.Fizz(in)
+			api.Buzz(in)
+		}
+		// The cassette is saved when the API stops.
+		cancel()
+		wg.Wait()
+	}
+
+	// No server is started, so the answers come from the cassette, and there's nothing to wait for.
+	api := runAPI(t, WithCassette(fizzBuzzCassette, ReplayCassette))
+	if err := api.WaitReady(context.Background()); err != nil {
+		t.Errorf("WaitReady() error: %v", err)
+	}
+	for in := 1; in <= 15; in++ {
+		if got, expected := api.Fizz(in), in%3 == 0; got != expected {
+			t.Errorf("Fizz(%d) = %v, expected %v", in, got, expected)
+		}
+		if got, expected := api.Buzz(in), in%5 == 0; got != expected {
+			t.Errorf("Buzz(%d) = %v, expected %v", in, got, expected)
+		}
+	}
+}
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	// The server fails once, so the recording has a failure followed by a successful retry.
+	srv := newTestServer(t, inTurn(divideServer(t), withStatus(http.StatusServiceUnavailable, "")))
+	recorder, err := NewCassette(path, RecordCassette, srv.Client().Transport)
+	if err != nil {
+		t.Fatalf("NewCassette() error: %v", err)
+	}
+	api := API{baseURL: srv.URL, client: &http.Client{Transport: recorder}}
+	if _, err := api.divide(10, 3); err == nil || err.Error() != "unexpected status code: 503 Service Unavailable: Service Unavailable" {
+		t.Fatalf("Expected the server error, got %v", err)
+	}
+	if result, err := api.divide(10, 3); err != nil || result != 1 {
+		t.Fatalf("Expected result 1, got %d and error %v", result, err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	// The replay gives the same answers in the same order, then repeats the last.
+	player, err := NewCassette(path, ReplayCassette, nil)
+	if err != nil {
+		t.Fatalf("NewCassette() error: %v", err)
+	}
+	api = API{baseURL: offlineBaseURL, client: &http.Client{Transport: player}}
+	if _, err := api.divide(10, 3); err == nil || err.Error() != "unexpected status code: 503 Service Unavailable: Service Unavailable" {
+		t.Errorf("Expected the recorded error, got %v", err)
+	}
+	for range 2 {
+		if result, err := api.divide(10, 3); err != nil || result != 1 {
+			t.Errorf("Expected result 1, got %d and error %v", result, err)
+		}
+	}
+	if got := srv.calls.Load(); got != 2 {
+		t.Errorf("Expected only the recorded calls to reach the server, got %d", got)
+	}
+
+	// Requests which weren't recorded fail.
+	var transportErr *TransportError
+	if _, err := api.divide(10, 4); !errors.Is(err, ErrNoInteraction) || !errors.As(err, &transportErr) {
+		t.Errorf("Expected a transport error for an unrecorded request, got %v", err)
+	}
+}
+
+func TestCassette_RecordTooLarge(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 2*maxRecordedBodySize)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := NewCassette(path, RecordCassette, srv.Client().Transport)
+	if err != nil {
+		t.Fatalf("NewCassette() error: %v", err)
+	}
+
+	// The API's own limit still applies.
+	api := API{baseURL: srv.URL, client: &http.Client{Transport: recorder}}
+	if _, err := api.divide(10, 3); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("Expected ErrResponseTooLarge, got %v", err)
+	}
+
+	// Other callers get the whole body, although it isn't recorded.
+	resp, err := (&http.Client{Transport: recorder}).Get(srv.URL + "/divide?a=10&b=3")
+	if err != nil {
+		t.Fatalf("Failed to call server: %v", err)
+	}
+	got, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !bytes.Equal(got, body) {
+		t.Errorf("Expected the whole body, got %d bytes and error %v", len(got), err)
+	}
+
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read cassette: %v", err)
+	}
+	if strings.Contains(string(data), `"method"`) {
+		t.Errorf("Expected nothing to be recorded, got:\n%s", data)
+	}
+}
+
+func TestCassette_PassThrough(t *testing.T) {
+	srv := newTestServer(t, divideServer(t))
+	player, err := NewCassette(fizzBuzzCassette, ReplayCassettePassThrough, srv.Client().Transport)
+	if err != nil {
+		t.Fatalf("NewCassette() error: %v", err)
+	}
+	api := API{baseURL: srv.URL, client: &http.Client{Transport: player}}
+
+	// Recorded requests are replayed, whatever the server's address.
+	if result, err := api.divide(9, 3); err != nil || result != 0 {
+		t.Errorf("Expected the recorded result 0, got %d and error %v", result, err)
+	}
+	if got := srv.calls.Load(); got != 0 {
+		t.Errorf("Expected no calls to the server, got %d", got)
+	}
+
+	// Others are passed on to the server.
+	if result, err := api.divide(10, 4); err != nil || result != 2 {
+		t.Errorf("Expected the server's result 2, got %d and error %v", result, err)
+	}
+	if got := srv.calls.Load(); got != 1 {
+		t.Errorf("Expected 1 call to the server, got %d", got)
+	}
+}
+
+func TestNew_InvalidCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+	if _, _, err := New(context.Background(), &sync.WaitGroup{}, WithCassette(path, ReplayCassette)); err == nil {
+		t.Error("Expected an error for a missing cassette")
+	}
+}
@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"context"
+	"math/big"
+	"sync"
+)
+
+// WithCoalescing makes concurrent calls to divide the same numbers share one request to the
+// server. Each caller can still give up on its own, and the shared request is only cancelled when
+// every caller waiting for it has. By default every call makes its own request.
+func WithCoalescing() Option {
+	return func(api *API) {
+		// New sets the API's wait group before applying its options.
+		api.coalescer = newCoalescer(api.wg)
+	}
+}
+
+// CoalescingStats counts the calls made through the API while coalescing is on.
+type CoalescingStats struct {
+	Calls  int64 // Calls to divide.
+	Shared int64 // Calls which shared another call's request instead of making their own.
+}
+
+// flightKey identifies a division. The numbers are kept in decimal, as big.Ints can't be compared.
+type flightKey struct {
+	a, b string
+}
+
+// flight is a request to the server which one or more calls are waiting for.
+type flight struct {
+	done      chan struct{} // Closed once remainder and err are set.
+	remainder *big.Int
+	err       error
+
+	waiters int                // Calls still waiting. Protected by the coalescer's lock.
+	cancel  context.CancelFunc // Cancels the request.
+}
+
+// coalescer shares requests between concurrent identical calls.
+type coalescer struct {
+	wg *sync.WaitGroup // Tracks the requests in flight, which can outlive their callers.
+
+	mu      sync.Mutex
+	flights map[flightKey]*flight
+	stats   CoalescingStats
+}
+
+func newCoalescer(wg *sync.WaitGroup) *coalescer {
+	return &coalescer{wg: wg, flights: map[flightKey]*flight{}}
+}
+
+// do returns call's result for a and b, joining a call already in flight for them if there is one.
+// The call is given a context which keeps the values of the first caller's but is only cancelled
+// when every caller has given up.
+func (c *coalescer) do(ctx context.Context, a, b *big.Int, call func(context.Context) (*big.Int, error)) (*big.Int, error) {
+	key := flightKey{a: a.String(), b: b.String()}
+
+	c.mu.Lock()
+	c.stats.Calls++
+	f, ok := c.flights[key]
+	if ok {
+		c.stats.Shared++
+		f.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		c.flights[key] = f
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.run(callCtx, key, f, call)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, f.err
+		}
+		// Callers own the results they're given, so each gets its own copy.
+		return new(big.Int).Set(f.remainder), nil
+	case <-ctx.Done():
+		c.leave(key, f)
+		return nil, ctx.Err()
+	}
+}
+
+// run makes the call for a flight and hands its result to the waiting callers.
+func (c *coalescer) run(ctx context.Context, key flightKey, f *flight, call func(context.Context) (*big.Int, error)) {
+	remainder, err := call(ctx)
+	f.cancel()
+
+	c.mu.Lock()
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	c.mu.Unlock()
+
+	f.remainder, f.err = remainder, err
+	close(f.done)
+}
+
+// leave removes a caller which has given up from a flight, cancelling it if nobody else is waiting.
+func (c *coalescer) leave(key flightKey, f *flight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	f.cancel()
+	// Later calls mustn't join a cancelled flight.
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+}
+
+// snapshot returns the coalescer's stats.
+func (c *coalescer) snapshot() CoalescingStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,150 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls until the condition is true, failing the test if it takes more than a second.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newTestCoalescer returns a coalescer whose requests are waited for when the test ends.
+func newTestCoalescer(t *testing.T) *coalescer {
+	wg := &sync.WaitGroup{}
+	t.Cleanup(wg.Wait)
+	return newCoalescer(wg)
+}
+
+func TestCoalescing(t *testing.T) {
+	release := make(chan struct{})
+	srv := newTestServer(t, holdUntil(release, divideServer(t)))
+	api := API{baseURL: srv.URL, client: srv.Client(), coalescer: newTestCoalescer(t)}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]int, callers+1)
+	errs := make([]error, callers+1)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = api.divide(2, 3)
+		}()
+	}
+	// A different division gets its own request.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[callers], errs[callers] = api.divide(1, 3)
+	}()
+
+	waitFor(t, func() bool { return api.CoalescingStats().Calls == callers+1 })
+	close(release)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Call %d: unexpected error: %v", i, err)
+		}
+	}
+	for i := range callers {
+		if results[i] != 2 {
+			t.Errorf("Call %d: expected result 2, got %d", i, results[i])
+		}
+	}
+	if results[callers] != 1 {
+		t.Errorf("Expected result 1 for the other division, got %d", results[callers])
+	}
+	if got := srv.calls.Load(); got != 2 {
+		t.Errorf("Expected 2 requests, got %d", got)
+	}
+	if got, expected := api.CoalescingStats(), (CoalescingStats{Calls: callers + 1, Shared: callers - 1}); got != expected {
+		t.Errorf("Expected stats %+v, got %+v", expected, got)
+	}
+
+	// Once the request has finished, the next call makes a new one.
+	if _, err := api.divide(2, 3); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := srv.calls.Load(); got != 3 {
+		t.Errorf("Expected 3 requests, got %d", got)
+	}
+}
+
+func TestCoalescing_Cancellation(t *testing.T) {
+	t.Run("One caller gives up", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := newTestServer(t, holdUntil(release, divideServer(t)))
+		api := API{baseURL: srv.URL, client: srv.Client(), coalescer: newTestCoalescer(t)}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+		go func() {
+			_, err := api.divideContext(ctx, 2, 3)
+			first <- err
+		}()
+		second := make(chan error, 1)
+		go func() {
+			_, err := api.divideContext(context.Background(), 2, 3)
+			second <- err
+		}()
+		waitFor(t, func() bool { return api.CoalescingStats().Calls == 2 })
+
+		// The first caller gives up, but the request carries on for the second.
+		cancel()
+		if err := <-first; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the first call to be cancelled, got %v", err)
+		}
+		close(release)
+		if err := <-second; err != nil {
+			t.Errorf("Unexpected error for the second call: %v", err)
+		}
+		if got := srv.cancelled.Load(); got != 0 {
+			t.Errorf("Expected the shared request not to be cancelled, got %d cancelled", got)
+		}
+	})
+
+	t.Run("Every caller gives up", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		srv := newTestServer(t, holdUntil(release, divideServer(t)))
+		api := API{baseURL: srv.URL, client: srv.Client(), coalescer: newTestCoalescer(t)}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := api.divideContext(ctx, 2, 3); !errors.Is(err, context.Canceled) {
+					t.Errorf("Expected the call to be cancelled, got %v", err)
+				}
+			}()
+		}
+		waitFor(t, func() bool { return srv.calls.Load() == 1 && api.CoalescingStats().Calls == 2 })
+		cancel()
+		wg.Wait()
+
+		// The request is cancelled, and a new call doesn't join it.
+		waitFor(t, func() bool { return srv.cancelled.Load() == 1 })
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		api.divideContext(ctx, 2, 3)
+		if got := srv.calls.Load(); got != 2 {
+			t.Errorf("Expected a new request, got %d requests", got)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrResponseTooLarge is wrapped by errors for responses larger than the API accepts.
+	ErrResponseTooLarge = errors.New("response too large")
+
+	// ErrUnknownLength is wrapped by errors for responses without a Content-Length, when
+	// WithRequireContentLength makes the API insist on one.
+	ErrUnknownLength = errors.New("response has unknown length")
+)
+
+// APIError is an error response from the divide server.
+// Servers which send Problem Details fill in every field, older servers just the status, message
+// and detail.
+type APIError struct {
+	StatusCode int
+	Status     string // For example "400 Bad Request".
+	Message    string // The Problem's detail, or its title if it has none, or a legacy error's message.
+
+	Type     string
+	Title    string
+	Detail   string
+	Instance string
+	Code     string // Machine-readable, for example server.CodeDivisionByZero.
+
+	RetryAfter time.Duration // How long the server asked the client to wait, from a Retry-After header.
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	switch {
+	case e.StatusCode >= 400 && e.StatusCode <= 499, e.StatusCode == http.StatusInternalServerError:
+		return fmt.Sprintf("%s: %s", e.Status, e.Message)
+	default:
+		return fmt.Sprintf("unexpected status code: %s: %s", e.Status, e.Message)
+	}
+}
+
+// DecodeError is a response from the divide server which couldn't be decoded.
+type DecodeError struct {
+	StatusCode int
+	Problem    bool          // Whether the response claimed to be a Problem.
+	RetryAfter time.Duration // How long the server asked the client to wait, from a Retry-After header.
+	Err        error
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	switch {
+	case e.StatusCode == http.StatusOK:
+		return fmt.Sprintf("failed to decode result response: %v", e.Err)
+	case e.Problem:
+		return fmt.Sprintf("failed to decode problem response for status code %d: %v", e.StatusCode, e.Err)
+	default:
+		return fmt.Sprintf("failed to decode error response for status code %d: %v", e.StatusCode, e.Err)
+	}
+}
+
+// Unwrap returns the decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// TransportError is a failure to call the divide server or to read its response, for example
+// because the connection was refused or dropped.
+type TransportError struct {
+	Status string // The status of the response whose body couldn't be read, or empty if there wasn't one.
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *TransportError) Error() string {
+	if e.Status == "" {
+		return fmt.Sprintf("failed to call API: %v", e.Err)
+	}
+	return fmt.Sprintf("failed to read response body on response status %s: %v", e.Status, e.Err)
+}
+
+// Unwrap returns the underlying error, for example a *url.Error or context.DeadlineExceeded.
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,204 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+)
+
+// minHedgeSamples is how many latencies must be seen before the percentile is used for the
+// hedge delay. Until then MaxDelay is used.
+const minHedgeSamples = 10
+
+// HedgePolicy configures hedged calls.
+//
+// When a call hasn't answered after the Percentile latency of recent calls, clamped between
+// MinDelay and MaxDelay, an identical second call is made. With several endpoints it usually goes
+// to another one. Whichever answers first is used and the other is cancelled.
+//
+// Every call adds MaxRatio to a budget, which holds at most 1, and every hedge takes 1 from it,
+// so a MaxRatio of 0.1 lets hedging add at most 10% to the calls made. MaxRatio is capped at 1,
+// so hedging never more than doubles the load.
+type HedgePolicy struct {
+	Percentile float64 // For example 0.95 for the 95th percentile. Clamped between 0 and 1.
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+	MaxRatio   float64
+	Window     int // How many recent latencies the percentile is taken from.
+}
+
+// DefaultHedgePolicy returns a policy which hedges calls slower than the 95th percentile, adding
+// at most 5% to the load.
+func DefaultHedgePolicy() HedgePolicy {
+	return HedgePolicy{
+		Percentile: 0.95,
+		MinDelay:   time.Millisecond,
+		MaxDelay:   time.Second,
+		MaxRatio:   0.05,
+		Window:     1000,
+	}
+}
+
+// WithHedging makes the API hedge slow calls according to the policy. Hedging happens within each
+// attempt, so a retry policy retries a call only if both of its requests fail.
+// By default calls aren't hedged.
+func WithHedging(policy HedgePolicy) Option {
+	return func(api *API) {
+		api.hedger = newHedger(policy)
+	}
+}
+
+// HedgingStats counts the calls made through the API while hedging is on.
+type HedgingStats struct {
+	Calls  int64 // Calls to divide, counting each retry.
+	Hedged int64 // Calls which made a second request.
+	Won    int64 // Hedged calls answered by the second request.
+}
+
+// hedger applies a HedgePolicy.
+type hedger struct {
+	policy HedgePolicy
+
+	mu        sync.Mutex
+	latencies []time.Duration // The most recent latencies, used as a ring.
+	next      int             // Where the next latency goes in the ring.
+	tokens    float64         // The hedging budget.
+	stats     HedgingStats
+}
+
+func newHedger(policy HedgePolicy) *hedger {
+	if math.IsNaN(policy.Percentile) {
+		policy.Percentile = DefaultHedgePolicy().Percentile
+	}
+	policy.Percentile = min(max(policy.Percentile, 0), 1)
+	policy.MaxRatio = min(policy.MaxRatio, 1)
+	policy.Window = max(policy.Window, minHedgeSamples)
+	return &hedger{policy: policy}
+}
+
+// delay returns how long to wait for a call before hedging it.
+func (h *hedger) delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < minHedgeSamples {
+		return h.policy.MaxDelay
+	}
+	sorted := slices.Clone(h.latencies)
+	slices.Sort(sorted)
+	d := sorted[int(h.policy.Percentile*float64(len(sorted)-1))]
+	return min(max(d, h.policy.MinDelay), h.policy.MaxDelay)
+}
+
+// observe records how long a call took.
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < h.policy.Window {
+		h.latencies = append(h.latencies, d)
+		return
+	}
+	h.latencies[h.next] = d
+	h.next = (h.next + 1) % h.policy.Window
+}
+
+// start counts a call and adds to the budget.
+func (h *hedger) start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stats.Calls++
+	h.tokens = min(h.tokens+h.policy.MaxRatio, 1)
+}
+
+// hedge takes a hedge from the budget, reporting whether there was one to take.
+func (h *hedger) hedge() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	h.stats.Hedged++
+	return true
+}
+
+// won counts a call answered by its hedge.
+func (h *hedger) won() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stats.Won++
+}
+
+// snapshot returns the hedger's stats.
+func (h *hedger) snapshot() HedgingStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// do makes the call, and a second identical one if the first is slow, returning the first
+// success. If both fail, the first error is returned.
+func (h *hedger) do(ctx context.Context, requestID string, call func(context.Context) (*big.Int, error)) (*big.Int, error) {
+	h.start()
+
+	// Cancelling the context on return stops whichever request is still in flight.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		remainder *big.Int
+		err       error
+		hedge     bool
+	}
+	// Buffered, so that a request finishing after do has returned doesn't block.
+	outcomes := make(chan outcome, 2)
+	launch := func(hedge bool) {
+		go func() {
+			remainder, err := call(ctx)
+			outcomes <- outcome{remainder: remainder, err: err, hedge: hedge}
+		}()
+	}
+
+	began := time.Now()
+	launch(false)
+	inFlight := 1
+	timer := time.NewTimer(h.delay())
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if h.hedge() {
+				slog.Debug("Hedging slow divide API call",
+					slog.Duration("after", time.Since(began)),
+					slog.String("request_id", requestID))
+				launch(true)
+				inFlight++
+			}
+		case o := <-outcomes:
+			inFlight--
+			if o.err == nil {
+				// When the hedge wins, the first request took at least this long too.
+				h.observe(time.Since(began))
+				if o.hedge {
+					h.won()
+				}
+				return o.remainder, nil
+			}
+			if firstErr == nil {
+				firstErr = o.err
+			}
+			if inFlight == 0 {
+				// A request which fails before the hedge delay isn't hedged. Failures are for the
+				// retry policy.
+				return nil, firstErr
+			}
+		}
+	}
+}
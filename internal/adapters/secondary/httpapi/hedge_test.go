@@ -0,0 +1,151 @@
+package httpapi
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedging(t *testing.T) {
+	// The first request stalls, so the hedge answers.
+	srv := newTestServer(t, inTurn(divideServer(t), holdUntil(nil, nil)))
+	policy := HedgePolicy{Percentile: 0.95, MinDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxRatio: 1}
+	api := API{baseURL: srv.URL, client: srv.Client(), hedger: newHedger(policy)}
+
+	start := time.Now()
+	result, err := api.divide(10, 3)
+	if err != nil || result != 1 {
+		t.Fatalf("Expected result 1, got %d and error %v", result, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the hedge to answer quickly, took %v", elapsed)
+	}
+	if got, expected := api.HedgingStats(), (HedgingStats{Calls: 1, Hedged: 1, Won: 1}); got != expected {
+		t.Errorf("Expected stats %+v, got %+v", expected, got)
+	}
+	// The stalled request is cancelled.
+	waitFor(t, func() bool { return srv.cancelled.Load() == 1 })
+
+	// A fast call isn't hedged.
+	if _, err := api.divide(10, 3); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := api.HedgingStats().Hedged; got != 1 {
+		t.Errorf("Expected no more hedges, got %d", got)
+	}
+}
+
+func TestHedging_Budget(t *testing.T) {
+	// Requests stall unless another is already stalled, so every first request stalls and every
+	// hedge answers.
+	var stalled atomic.Int32
+	stall, healthy := holdUntil(nil, nil), divideServer(t)
+	srv := newTestServer(t, func(call int32, w http.ResponseWriter, r *http.Request) {
+		defer stalled.Add(-1)
+		if stalled.Add(1) == 1 {
+			stall(call, w, r)
+			return
+		}
+		healthy(call, w, r)
+	})
+
+	policy := HedgePolicy{MinDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxRatio: 0.5}
+	api := API{baseURL: srv.URL, client: srv.Client(), hedger: newHedger(policy), callTimeout: 50 * time.Millisecond}
+
+	// Half of the calls can be hedged. The others time out waiting for their stalled request.
+	succeeded := 0
+	for range 10 {
+		if _, err := api.divide(10, 3); err == nil {
+			succeeded++
+		}
+		waitFor(t, func() bool { return stalled.Load() == 0 })
+	}
+	stats := api.HedgingStats()
+	if stats.Calls != 10 || stats.Hedged != 5 {
+		t.Errorf("Expected 5 of 10 calls to be hedged, got %+v", stats)
+	}
+	if succeeded != 5 || stats.Won != 5 {
+		t.Errorf("Expected only the hedged calls to succeed, got %d successes and %+v", succeeded, stats)
+	}
+}
+
+func TestHedging_Failure(t *testing.T) {
+	srv := newTestServer(t, divideServer(t))
+	api := API{baseURL: srv.URL, client: srv.Client(), hedger: newHedger(HedgePolicy{MaxDelay: time.Second, MaxRatio: 1})}
+
+	// A request which fails straight away isn't hedged.
+	if _, err := api.divide(10, 0); err == nil || err.Error() != "400 Bad Request: Division by zero is not allowed" {
+		t.Errorf("Expected the server error, got %v", err)
+	}
+	if got := srv.calls.Load(); got != 1 {
+		t.Errorf("Expected 1 call, got %d", got)
+	}
+}
+
+func TestHedger_Delay(t *testing.T) {
+	h := newHedger(HedgePolicy{Percentile: 0.9, MinDelay: 2 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Window: 10})
+
+	// Until there are enough latencies the maximum is used.
+	h.observe(time.Millisecond)
+	if got := h.delay(); got != 50*time.Millisecond {
+		t.Errorf("Expected the maximum delay, got %v", got)
+	}
+
+	// 1ms to 10ms, whose 90th percentile is 9ms.
+	h = newHedger(h.policy)
+	for i := range 10 {
+		h.observe(time.Duration(i+1) * time.Millisecond)
+	}
+	if got := h.delay(); got != 9*time.Millisecond {
+		t.Errorf("Expected a delay of 9ms, got %v", got)
+	}
+
+	// The oldest latencies make way for new ones, which are clamped to the limits.
+	for range 10 {
+		h.observe(time.Second)
+	}
+	if got := h.delay(); got != 50*time.Millisecond {
+		t.Errorf("Expected the maximum delay, got %v", got)
+	}
+	for range 10 {
+		h.observe(0)
+	}
+	if got := h.delay(); got != 2*time.Millisecond {
+		t.Errorf("Expected the minimum delay, got %v", got)
+	}
+
+	// Percentiles outside 0 to 1 are clamped, and NaN gives the default, rather than indexing
+	// outside the latencies.
+	for percentile, expected := range map[float64]time.Duration{1.5: 10 * time.Millisecond, -0.5: time.Millisecond, math.NaN(): 9 * time.Millisecond} {
+		h = newHedger(HedgePolicy{Percentile: percentile, MaxDelay: time.Second, Window: 10})
+		for i := range 10 {
+			h.observe(time.Duration(i+1) * time.Millisecond)
+		}
+		if got := h.delay(); got != expected {
+			t.Errorf("Percentile %v: expected a delay of %v, got %v", percentile, expected, got)
+		}
+	}
+}
+
+func TestNew_WithHedging(t *testing.T) {
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg, WithHedging(DefaultHedgePolicy()))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	for in := 1; in <= 15; in++ {
+		if got, expected := api.Fizz(in), in%3 == 0; got != expected {
+			t.Errorf("Fizz(%d) = %v, expected %v", in, got, expected)
+		}
+	}
+	if got := api.HedgingStats().Calls; got != 15 {
+		t.Errorf("Expected 15 calls, got %d", got)
+	}
+}
@@ -1,49 +1,316 @@
 package httpapi
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math/big"
 	"net/http"
-	"net/http/httptest"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server"
 )
 
 const (
-	maxResponseSize = 1024 // 1 KB is the maximum supported response size.
-	requestPath     = "%s/divide?a=%d&b=%d"
+	maxResponseSize   = 1024 // 1 KB is the default maximum supported response size.
+	requestPath       = "%s/divide?a=%d&b=%d"
+	readyPath         = "%s/readyz"
+	readyPollInterval = 50 * time.Millisecond
+	offlineBaseURL    = "http://cassette.invalid" // Used when replaying a cassette without a server.
 )
 
 type API struct {
-	server *httptest.Server
-	ctx    context.Context
-	wg     *sync.WaitGroup
+	baseURL     string       // The divide service's URL, without a trailing slash.
+	client      *http.Client // Used for every call.
+	probeClient *http.Client // Used for health and readiness checks, or client if nil.
+	ctx         context.Context
+	wg          *sync.WaitGroup
+	format      server.Format
+	credentials *server.Credential
+	requestID   string // Sent with every request, so that client and server logs can be matched.
+	maxResponse int64  // Largest response body accepted, or 0 for maxResponseSize.
+
+	serverOpts    []server.Option
+	clientCerts   []tls.Certificate
+	rootCAs       *x509.CertPool
+	cache         Cache
+	socketPath    string
+	h2c           bool
+	retrier       *retrier // If nil, calls aren't retried.
+	breaker       *breaker // If nil, there's no circuit breaker.
+	userClient    bool     // Whether the client was supplied with WithHTTPClient.
+	callTimeout   time.Duration
+	coalescer     *coalescer // If nil, calls aren't coalesced.
+	requireLength bool
+	compress      bool
+
+	endpointURLs  []string
+	balancePolicy *BalancePolicy
+	balancer      *balancer // If nil, every call goes to baseURL.
+	hedger        *hedger   // If nil, calls aren't hedged.
+
+	cassettePath string
+	cassetteMode CassetteMode
+	cassette     *Cassette // If nil, exchanges aren't recorded or replayed.
+}
+
+// Option configures an API instance created by New.
+type Option func(*API)
+
+// WithFormat sets the format the API asks the server to encode its responses in.
+// The server's default, JSON, is used if this option isn't supplied.
+func WithFormat(format server.Format) Option {
+	return func(api *API) {
+		api.format = format
+	}
+}
+
+// WithCredentials makes the API send an API key with every request, and sign them with the
+// secret if it isn't empty. The embedded server is configured to require the same credentials.
+func WithCredentials(key string, secret []byte) Option {
+	return func(api *API) {
+		cred := server.Credential{Key: key, Secret: secret}
+		api.credentials = &cred
+		api.serverOpts = append(api.serverOpts, server.WithCredentials(cred))
+	}
+}
+
+// WithRequestID sets the request ID sent with every call, for example to tie a run's requests
+// to the run in logs. By default a random ID is generated for each API instance.
+func WithRequestID(id string) Option {
+	return func(api *API) {
+		api.requestID = id
+	}
+}
+
+// WithMaxResponseSize sets the largest response body, in bytes, the API will accept.
+// The default is 1 KB, which is plenty for a division result.
+func WithMaxResponseSize(size int64) Option {
+	return func(api *API) {
+		api.maxResponse = size
+	}
+}
+
+// WithClientCertificate makes the API present the certificate to servers which require mutual TLS.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(api *API) {
+		api.clientCerts = append(api.clientCerts, cert)
+	}
+}
+
+// WithRootCAs sets the CAs the API trusts to sign the server's certificate.
+// By default the API trusts the embedded server's certificate.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(api *API) {
+		api.rootCAs = pool
+	}
+}
+
+// WithUnixSocket makes the embedded divide server listen on a Unix domain socket at path, and the
+// API call it through the socket instead of TCP loopback.
+func WithUnixSocket(path string) Option {
+	return func(api *API) {
+		api.socketPath = path
+		api.serverOpts = append(api.serverOpts, server.WithUnixSocket(path, 0))
+	}
+}
+
+// WithH2C makes the embedded divide server accept unencrypted HTTP/2, and the API use it, so that
+// concurrent calls share one multiplexed connection rather than each needing their own.
+func WithH2C() Option {
+	return func(api *API) {
+		api.h2c = true
+		api.serverOpts = append(api.serverOpts, server.WithH2C())
+	}
+}
+
+// WithBaseURL makes the API call the divide service at baseURL, for example
+// "https://divide.example.com", instead of starting an embedded server.
+func WithBaseURL(baseURL string) Option {
+	return func(api *API) {
+		api.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient makes the API use the client for every call, for example to set timeouts or
+// proxies for a remote divide service. The client is used as it is, so it can't be combined with
+// options which configure the client's transport, such as WithClientCertificate.
+// By default the API uses a client for the embedded server, or a new one for a base URL.
+func WithHTTPClient(client *http.Client) Option {
+	return func(api *API) {
+		api.client = client
+		api.userClient = true
+	}
+}
+
+// WithCallTimeout sets a deadline for each division, including any retries. Callers can also
+// pass a context with a deadline to DivideBigContext, FizzContext or BuzzContext.
+// By default there's no timeout.
+func WithCallTimeout(timeout time.Duration) Option {
+	return func(api *API) {
+		api.callTimeout = timeout
+	}
+}
+
+// WithRequireContentLength makes the API reject responses without a Content-Length, such as
+// chunked ones, with ErrUnknownLength, rather than reading them up to the maximum response size.
+func WithRequireContentLength() Option {
+	return func(api *API) {
+		api.requireLength = true
+	}
+}
+
+// WithCompression makes the API ask for compressed responses, and the embedded divide server
+// compress those of at least server.DefaultCompressionMinSize bytes. The maximum response size
+// applies to responses both before and after they're decompressed.
+func WithCompression() Option {
+	return func(api *API) {
+		api.compress = true
+		api.serverOpts = append(api.serverOpts, server.WithCompression(server.DefaultCompressionMinSize))
+	}
+}
+
+// WithServerOptions configures the embedded divide server, for example to apply rate limits.
+// They're ignored when calling a remote service with WithBaseURL.
+func WithServerOptions(opts ...server.Option) Option {
+	return func(api *API) {
+		api.serverOpts = append(api.serverOpts, opts...)
+	}
 }
 
-// New creates a new API instance with an embedded httptest Server.
+// New creates a new API instance. By default it calls an embedded httptest Server, which it starts,
+// but WithBaseURL points it at a remote divide service instead.
 // The caller should supply a context to control when the server should be closed, or the function will create one for you.
 // The caller is responsible for calling the returned cancel function to cleanly stop the server,
 // and should wait on the supplied WaitGroup to ensure all the server has stopped.
-func New(ctx context.Context, wg *sync.WaitGroup) (*API, context.CancelFunc, error) {
+func New(ctx context.Context, wg *sync.WaitGroup, opts ...Option) (*API, context.CancelFunc, error) {
 	if wg == nil {
 		return nil, nil, fmt.Errorf("wait group cannot be nil")
 	}
 
+	api := API{
+		wg:        wg,
+		requestID: server.NewRequestID(),
+	}
+	for _, opt := range opts {
+		opt(&api)
+	}
+
+	configuresTransport := len(api.clientCerts) > 0 || api.rootCAs != nil || api.socketPath != "" || api.h2c
+	if api.userClient {
+		if api.client == nil {
+			return nil, nil, fmt.Errorf("http client cannot be nil")
+		}
+		if configuresTransport {
+			return nil, nil, fmt.Errorf("an http client cannot be combined with options which configure its transport")
+		}
+	}
+
+	var srv *server.Server
+	var transport http.RoundTripper
+	if len(api.endpointURLs) > 0 {
+		if api.baseURL != "" {
+			return nil, nil, fmt.Errorf("a base URL cannot be combined with endpoints")
+		}
+		for i, endpointURL := range api.endpointURLs {
+			endpointURL = strings.TrimSuffix(endpointURL, "/")
+			if err := validateBaseURL(endpointURL); err != nil {
+				return nil, nil, err
+			}
+			api.endpointURLs[i] = endpointURL
+		}
+		policy := DefaultBalancePolicy()
+		if api.balancePolicy != nil {
+			policy = *api.balancePolicy
+		}
+		api.balancer = newBalancer(policy, api.endpointURLs)
+		api.baseURL = api.endpointURLs[0]
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	} else if api.baseURL != "" {
+		if err := validateBaseURL(api.baseURL); err != nil {
+			return nil, nil, err
+		}
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	} else if api.cassettePath != "" && api.cassetteMode == ReplayCassette {
+		// Every request is answered from the cassette, so there's no need for a server.
+		api.baseURL = offlineBaseURL
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	} else {
+		var err error
+		srv, err = server.New(api.serverOpts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to start server: %w", err)
+		}
+		api.baseURL = srv.URL
+		// The server's client transport already trusts the server's certificate.
+		transport = srv.Client().Transport
+	}
+
+	if !api.userClient {
+		if configuresTransport {
+			transport := transport.(*http.Transport).Clone()
+			if api.socketPath != "" {
+				// Whatever the URL's host, connections go through the socket.
+				transport.DialContext = server.DialUnix(api.socketPath)
+			}
+			if api.h2c {
+				transport.Protocols = server.H2CClientProtocols()
+			}
+			if len(api.clientCerts) > 0 || api.rootCAs != nil {
+				if transport.TLSClientConfig == nil {
+					transport.TLSClientConfig = &tls.Config{}
+				}
+				transport.TLSClientConfig.Certificates = api.clientCerts
+				if api.rootCAs != nil {
+					transport.TLSClientConfig.RootCAs = api.rootCAs
+				}
+			}
+			api.client = &http.Client{Transport: transport}
+		} else if srv != nil {
+			api.client = srv.Client()
+		} else {
+			api.client = &http.Client{Transport: transport}
+		}
+	}
+	// Health and readiness checks go straight to the server, rather than being recorded,
+	// replayed or cached.
+	api.probeClient = api.client
+	if api.cassettePath != "" {
+		cassette, err := NewCassette(api.cassettePath, api.cassetteMode, api.client.Transport)
+		if err != nil {
+			if srv != nil {
+				srv.Close()
+			}
+			return nil, nil, err
+		}
+		api.cassette = cassette
+		// The caller's client is copied rather than changed.
+		client := *api.client
+		client.Transport = cassette
+		api.client = &client
+	}
+	if api.cache != nil {
+		// The caller's client is copied rather than changed.
+		client := *api.client
+		client.Transport = newCachingTransport(client.Transport, api.cache)
+		api.client = &client
+	}
+
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	// Create a new context from the supplied one, with a cancel function that we'll return.
 	ctx, cancel := context.WithCancel(ctx)
-
-	api := API{
-		server: server.New(),
-		ctx:    ctx,
-		wg:     wg,
-	}
+	api.ctx = ctx
 
 	// Ensure the cancel function is called when the context is done
 	api.wg.Add(1)
@@ -51,12 +318,118 @@ func New(ctx context.Context, wg *sync.WaitGroup) (*API, context.CancelFunc, err
 		defer api.wg.Done()
 
 		<-api.ctx.Done()
-		api.server.Close()
+		if srv != nil {
+			srv.Close()
+		}
+		api.client.CloseIdleConnections()
+		if api.cassette != nil {
+			if err := api.cassette.Save(); err != nil {
+				slog.Error("Failed to save cassette", slog.String("path", api.cassettePath), slog.String("error", err.Error()))
+			}
+		}
 	}()
 
+	if api.balancer != nil && api.balancer.policy.HealthCheckInterval > 0 {
+		api.wg.Add(1)
+		go func() {
+			defer api.wg.Done()
+			api.balancer.runHealthChecks(api.ctx, api.probeClient)
+		}()
+	}
+
 	return &api, cancel, nil
 }
 
+// validateBaseURL returns an error unless baseURL is an absolute http or https URL.
+func validateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", baseURL)
+	}
+	return nil
+}
+
+// BaseURL returns the URL of the divide service the API calls, or of the first endpoint given to
+// WithEndpoints.
+func (api *API) BaseURL() string {
+	return api.baseURL
+}
+
+// RequestID returns the request ID sent with every call.
+func (api *API) RequestID() string {
+	return api.requestID
+}
+
+// WaitReady blocks until the server's readiness check succeeds, or the context is done.
+// Callers can use it to hold back a run until the divide service can take traffic. With several
+// endpoints, one being ready is enough. When replaying a cassette without a server, there's
+// nothing to wait for.
+func (api *API) WaitReady(ctx context.Context) error {
+	if api.baseURL == offlineBaseURL {
+		return nil
+	}
+
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, baseURL := range api.urls() {
+			if probe(ctx, api.checkClient(), fmt.Sprintf(readyPath, baseURL)) {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server not ready: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Endpoints returns the status of each endpoint given to WithEndpoints.
+func (api *API) Endpoints() []EndpointStatus {
+	if api.balancer == nil {
+		return nil
+	}
+	return api.balancer.status()
+}
+
+// Available implements the repository.AvailabilityChecker interface. It returns ErrCircuitOpen
+// while the circuit breaker is open, so callers can stop trusting Fizz and Buzz.
+func (api *API) Available() error {
+	if api.breaker == nil {
+		return nil
+	}
+	return api.breaker.available()
+}
+
+// BreakerState returns the state of the circuit breaker, which is always closed if there isn't one.
+func (api *API) BreakerState() BreakerState {
+	if api.breaker == nil {
+		return BreakerClosed
+	}
+	return api.breaker.currentState()
+}
+
+// CoalescingStats returns counts of the calls made since the API was created, and how many of
+// them shared a request with another call. They're zero unless WithCoalescing was used.
+func (api *API) CoalescingStats() CoalescingStats {
+	if api.coalescer == nil {
+		return CoalescingStats{}
+	}
+	return api.coalescer.snapshot()
+}
+
+// HedgingStats returns counts of the calls made since the API was created, and how many were
+// hedged. They're zero unless WithHedging was used.
+func (api *API) HedgingStats() HedgingStats {
+	if api.hedger == nil {
+		return HedgingStats{}
+	}
+	return api.hedger.snapshot()
+}
+
 // Fizz implements the repository.FizzBuzzer interface.
 // Errors are logged and result in a false return value.
 func (api *API) Fizz(in int) bool {
@@ -69,69 +442,329 @@ func (api *API) Buzz(in int) bool {
 	return api.commonDivide(in, 5)
 }
 
+// FizzContext implements the repository.ContextFizzBuzzer interface.
+func (api *API) FizzContext(ctx context.Context, in int) (bool, error) {
+	return api.commonDivideContext(ctx, in, 3)
+}
+
+// BuzzContext implements the repository.ContextFizzBuzzer interface.
+func (api *API) BuzzContext(ctx context.Context, in int) (bool, error) {
+	return api.commonDivideContext(ctx, in, 5)
+}
+
 func (api *API) commonDivide(in int, divisor int) bool {
-	result, err := api.divide(in, divisor)
+	divisible, err := api.commonDivideContext(api.context(), in, divisor)
 	if err != nil {
-		slog.Error("Error calling divide API", slog.String("error", err.Error()))
+		slog.Error("Error calling divide API", slog.String("error", err.Error()), slog.String("request_id", api.requestID))
 		return false
 	}
-	return result == 0
+	return divisible
+}
+
+func (api *API) commonDivideContext(ctx context.Context, in int, divisor int) (bool, error) {
+	result, err := api.divideContext(ctx, in, divisor)
+	if err != nil {
+		return false, err
+	}
+	return result == 0, nil
 }
 
-// divide calls the internal httptest server to perform a division operation, simulating
-// an external HTTP API call. Any errors returned from the server are logged and returned to the caller.
+// divide is divideContext using the API's context.
 func (api *API) divide(a, b int) (int, error) {
+	return api.divideContext(api.context(), a, b)
+}
+
+// divideContext is DivideBigContext for ints. The remainder is always smaller than b, so it fits in an int.
+func (api *API) divideContext(ctx context.Context, a, b int) (int, error) {
+	remainder, err := api.DivideBigContext(ctx, big.NewInt(int64(a)), big.NewInt(int64(b)))
+	if err != nil {
+		return 0, err
+	}
+	return int(remainder.Int64()), nil
+}
+
+// DivideBig is DivideBigContext using the API's context, so calls are only cancelled when the API
+// is stopped.
+func (api *API) DivideBig(a, b *big.Int) (*big.Int, error) {
+	return api.DivideBigContext(api.context(), a, b)
+}
+
+// DivideBigContext calls the divide service, embedded or remote, to perform a division operation.
+// It supports integers of any size, up to the server's limit of
+// 4096 digits, though divisors of hundreds of digits need a larger WithMaxResponseSize.
+// The remainder has the sign of a, as with Go's % operator.
+// Any errors returned from the server are returned to the caller. The call, including any
+// retries, stops when the context is done or the API's call timeout passes.
+func (api *API) DivideBigContext(ctx context.Context, a, b *big.Int) (*big.Int, error) {
+	if api.coalescer == nil {
+		return api.divideBreaking(ctx, a, b)
+	}
+	return api.coalescer.do(ctx, a, b, func(ctx context.Context) (*big.Int, error) {
+		return api.divideBreaking(ctx, a, b)
+	})
+}
+
+// divideBreaking calls the divide API through the circuit breaker, if there is one.
+func (api *API) divideBreaking(ctx context.Context, a, b *big.Int) (*big.Int, error) {
+	if api.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.callTimeout)
+		defer cancel()
+	}
+
+	if api.breaker == nil {
+		return api.divideRetrying(ctx, a, b)
+	}
+	if err := api.breaker.allow(); err != nil {
+		return nil, err
+	}
+	remainder, err := api.divideRetrying(ctx, a, b)
+	api.breaker.done(err)
+	return remainder, err
+}
+
+// divideRetrying calls the divide API, retrying according to the API's retry policy.
+func (api *API) divideRetrying(ctx context.Context, a, b *big.Int) (*big.Int, error) {
+	if api.retrier == nil {
+		return api.divideHedged(ctx, a, b)
+	}
+
+	var remainder *big.Int
+	err := api.retrier.do(ctx, api.requestID, func() error {
+		var err error
+		remainder, err = api.divideHedged(ctx, a, b)
+		return err
+	})
+	return remainder, err
+}
+
+// divideHedged calls the divide API, hedging slow calls according to the API's hedge policy.
+func (api *API) divideHedged(ctx context.Context, a, b *big.Int) (*big.Int, error) {
+	if api.hedger == nil {
+		return api.divideOnce(ctx, a, b)
+	}
+	return api.hedger.do(ctx, api.requestID, func(ctx context.Context) (*big.Int, error) {
+		return api.divideOnce(ctx, a, b)
+	})
+}
+
+// divideOnce makes a single call to the divide API. With several endpoints, a call which fails
+// because of the endpoint is tried on the others straight away.
+func (api *API) divideOnce(ctx context.Context, a, b *big.Int) (*big.Int, error) {
+	if api.balancer == nil {
+		return api.divideAt(ctx, api.baseURL, a, b)
+	}
+
+	var err error
+	for i, e := range api.balancer.order(a.String()) {
+		if i > 0 {
+			slog.Warn("Failing over to another divide endpoint",
+				slog.String("error", err.Error()),
+				slog.String("endpoint", e.url),
+				slog.String("request_id", api.requestID))
+		}
+
+		e.outstanding.Add(1)
+		var remainder *big.Int
+		remainder, err = api.divideAt(ctx, e.url, a, b)
+		e.outstanding.Add(-1)
+
+		failed, _ := retryable(err)
+		if !errors.Is(err, context.Canceled) {
+			api.balancer.record(e, failed)
+		}
+		if !failed || ctx.Err() != nil {
+			return remainder, err
+		}
+	}
+	return nil, err
+}
+
+// divideAt makes a single call to the divide API at baseURL.
+func (api *API) divideAt(ctx context.Context, baseURL string, a, b *big.Int) (*big.Int, error) {
 
 	// Construct the API URL
-	url := fmt.Sprintf(requestPath, api.server.URL, a, b)
+	requestURL := fmt.Sprintf(requestPath, baseURL, a, b)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	// Ask for errors as Problem Details, which carry a machine-readable code.
+	req.Header.Set("Accept", string(api.resultFormat())+", "+server.ProblemContentType)
+	if api.compress {
+		// Setting Accept-Encoding also stops the transport decompressing gzip by itself, which
+		// would hide the compressed size.
+		req.Header.Set("Accept-Encoding", server.AcceptEncoding)
+	}
+	if api.requestID != "" {
+		req.Header.Set(server.RequestIDHeader, api.requestID)
+	}
+	if api.credentials != nil {
+		if err := server.SignRequest(req, *api.credentials, time.Now()); err != nil {
+			return nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
 
 	// Submit the HTTP GET request to the server
-	resp, err := api.server.Client().Get(url)
+	resp, err := api.httpClient().Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to call API: %w", err)
+		return nil, &TransportError{Err: err}
 	}
 	defer resp.Body.Close()
 
 	// Check the size of the response before we slurp it all into memory.
-	if resp.ContentLength > maxResponseSize {
-		return 0, fmt.Errorf("response too large: %d bytes", resp.ContentLength)
+	limit := api.responseLimit()
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseTooLarge, resp.ContentLength)
 	}
-	if resp.ContentLength < 0 {
-		// Note: unable to test this scenario without intercepting the response within this function.
-		return 0, fmt.Errorf("response size unknown, will not process")
+	if resp.ContentLength < 0 && api.requireLength {
+		return nil, ErrUnknownLength
 	}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+	// The Content-Length is unknown for chunked responses, so read through a bounded reader
+	// and reject the response if there's more than the limit.
+	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
 	if err != nil {
-		return 0, fmt.Errorf("failed to read response body on response status %s: %w", resp.Status, err)
+		return nil, &TransportError{Status: resp.Status, Err: err}
+	}
+	if int64(len(bodyBytes)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, limit)
 	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+		if bodyBytes, err = decompress(encoding, bodyBytes, limit); err != nil {
+			if !errors.Is(err, ErrResponseTooLarge) {
+				err = &DecodeError{StatusCode: resp.StatusCode, Err: err}
+			}
+			return nil, err
+		}
+	}
+
+	format := api.responseFormat(resp)
 
 	if resp.StatusCode == http.StatusOK {
-		// Decode the JSON response
+		// Decode the response in whichever format the server chose
 		var result server.DivisionResult
-		if err := json.Unmarshal(bodyBytes, &result); err != nil {
-			return 0, fmt.Errorf("failed to decode result response: %w", err)
+		if err := format.Unmarshal(bodyBytes, &result); err != nil {
+			return nil, &DecodeError{StatusCode: resp.StatusCode, Err: err}
 		}
-		return result.Remainder, nil
+		return result.Remainder.Big(), nil
+	}
+
+	return nil, decodeError(resp, bodyBytes, format)
+}
+
+// decompress decompresses a response body according to its Content-Encoding. A small body can
+// decompress to a huge one, so it's read through a bounded reader, and rejected if it decompresses
+// to more than the limit.
+func decompress(encoding string, body []byte, limit int64) ([]byte, error) {
+	r, err := server.Decompress(encoding, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes once decompressed", ErrResponseTooLarge, limit)
+	}
+	return decompressed, nil
+}
+
+// decodeError decodes an error response into an *APIError, whether it's a Problem or a legacy
+// ErrorResult in the given format. Responses which can't be decoded give a *DecodeError.
+func decodeError(resp *http.Response, body []byte, format server.Format) error {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: parseRetryAfter(resp.Header, time.Now()),
+	}
+
+	if server.IsProblemContentType(resp.Header.Get("Content-Type")) {
+		var problem server.Problem
+		if err := json.Unmarshal(body, &problem); err != nil {
+			return &DecodeError{StatusCode: resp.StatusCode, Problem: true, RetryAfter: apiErr.RetryAfter, Err: err}
+		}
+		apiErr.Type = problem.Type
+		apiErr.Title = problem.Title
+		apiErr.Detail = problem.Detail
+		apiErr.Instance = problem.Instance
+		apiErr.Code = problem.Code
+		apiErr.Message = problem.Detail
+		if apiErr.Message == "" {
+			apiErr.Message = problem.Title
+		}
+		return apiErr
 	}
 
-	// Handle error responses
 	var er server.ErrorResult
-	if err := json.Unmarshal(bodyBytes, &er); err != nil {
-		return 0, fmt.Errorf("failed to decode error response for status code %d: %w", resp.StatusCode, err)
+	if err := format.Unmarshal(body, &er); err != nil {
+		return &DecodeError{StatusCode: resp.StatusCode, RetryAfter: apiErr.RetryAfter, Err: err}
 	}
+	apiErr.Message = er.Message
+	apiErr.Detail = er.Message
+	return apiErr
+}
 
-	switch {
-	case resp.StatusCode == http.StatusBadRequest:
-		return 0, fmt.Errorf("%s: %s", resp.Status, er.Message)
+// urls returns the base URLs of the divide service.
+func (api *API) urls() []string {
+	if len(api.endpointURLs) > 0 {
+		return api.endpointURLs
+	}
+	return []string{api.baseURL}
+}
 
-	case resp.StatusCode >= 400 && resp.StatusCode <= 499:
-		return 0, fmt.Errorf("%s: %s", resp.Status, er.Message)
+// context returns the API's context, which is done when the API is stopped.
+func (api *API) context() context.Context {
+	if api.ctx == nil {
+		return context.Background()
+	}
+	return api.ctx
+}
 
-	case resp.StatusCode == http.StatusInternalServerError:
-		return 0, fmt.Errorf("%s: %s", resp.Status, er.Message)
+// responseLimit returns the largest response body the API will accept.
+func (api *API) responseLimit() int64 {
+	if api.maxResponse > 0 {
+		return api.maxResponse
+	}
+	return maxResponseSize
+}
+
+// httpClient returns the client used to call the server.
+func (api *API) httpClient() *http.Client {
+	if api.client != nil {
+		return api.client
+	}
+	return http.DefaultClient
+}
+
+// checkClient returns the HTTP client for health and readiness checks.
+func (api *API) checkClient() *http.Client {
+	if api.probeClient != nil {
+		return api.probeClient
+	}
+	return api.httpClient()
+}
+
+// resultFormat returns the format the API asks for results in.
+func (api *API) resultFormat() server.Format {
+	if api.format == "" {
+		return server.FormatJSON
+	}
+	return api.format
+}
 
-	default:
-		return 0, fmt.Errorf("unexpected status code: %s: %s", resp.Status, er.Message)
+// responseFormat returns the format of a response body.
+// The requested format is assumed unless the Content-Type header says the server fell back to
+// JSON, as it does for requests it can't satisfy. Other Content-Types are ignored, because a
+// server that doesn't set one gets a sniffed "text/plain" from net/http.
+func (api *API) responseFormat(resp *http.Response) server.Format {
+	requested := api.resultFormat()
+	if format, err := server.ParseFormat(resp.Header.Get("Content-Type")); err == nil && format == server.FormatJSON {
+		return format
 	}
+	return requested
 }
@@ -1,14 +1,27 @@
 package httpapi
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server"
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server/servertest"
 )
 
 const (
@@ -27,7 +40,7 @@ func TestDivide(t *testing.T) {
 	}{
 		{
 			name:           "Valid division",
-			apiResponse:    server.DivisionResult{Remainder: 1},
+			apiResponse:    server.DivisionResult{Remainder: server.NewNumber(1)},
 			apiStatusCode:  http.StatusOK,
 			expectedResult: 1,
 			expectedError:  "",
@@ -71,7 +84,7 @@ func TestDivide(t *testing.T) {
 		{
 			name:             "Content Length too large",
 			padResponseBytes: maxResponseSize + 1,
-			apiResponse:      server.DivisionResult{Remainder: 1},
+			apiResponse:      server.DivisionResult{Remainder: server.NewNumber(1)},
 			apiStatusCode:    http.StatusOK,
 			expectedError:    "response too large: 1041 bytes",
 		},
@@ -94,7 +107,8 @@ func TestDivide(t *testing.T) {
 
 			// Create an API instance using the mock server
 			api := API{
-				server: mockServer,
+				baseURL: mockServer.URL,
+				client:  mockServer.Client(),
 			}
 
 			// Call the divide function. The values of a and b don't matter, as we're using canned responses.
@@ -242,7 +256,7 @@ func TestAPI_FizzAndBuzz(t *testing.T) {
 				fields: fields{
 					server: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 						w.WriteHeader(http.StatusOK)
-						json.NewEncoder(w).Encode(server.DivisionResult{Remainder: 0})
+						json.NewEncoder(w).Encode(server.DivisionResult{Remainder: server.NewNumber(0)})
 					})),
 					funcToTest: funcToTest,
 				},
@@ -253,7 +267,7 @@ func TestAPI_FizzAndBuzz(t *testing.T) {
 				fields: fields{
 					server: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 						w.WriteHeader(http.StatusOK)
-						json.NewEncoder(w).Encode(server.DivisionResult{Remainder: 1})
+						json.NewEncoder(w).Encode(server.DivisionResult{Remainder: server.NewNumber(1)})
 					})),
 					funcToTest: funcToTest,
 				},
@@ -274,7 +288,8 @@ func TestAPI_FizzAndBuzz(t *testing.T) {
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 
-				api.server = tt.fields.server
+				api.baseURL = tt.fields.server.URL
+				api.client = tt.fields.server.Client()
 
 				if got := tt.fields.funcToTest(ignoredValue); got != tt.expectedBool {
 					t.Errorf("Function returned %v, want %v", got, tt.expectedBool)
@@ -283,3 +298,918 @@ func TestAPI_FizzAndBuzz(t *testing.T) {
 		}
 	}
 }
+
+func TestDivide_Formats(t *testing.T) {
+	srv, err := server.New()
+	if err != nil {
+		t.Fatalf("server.New() error: %v", err)
+	}
+	defer srv.Close()
+
+	for _, format := range []server.Format{server.FormatJSON, server.FormatXML, server.FormatText, server.FormatCBOR} {
+		t.Run(string(format), func(t *testing.T) {
+			api := API{
+				baseURL: srv.Server.URL,
+				client:  srv.Server.Client(),
+				format:  format,
+			}
+
+			result, err := api.divide(10, 3)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != 1 {
+				t.Errorf("Expected result 1, got %d", result)
+			}
+
+			// Errors are encoded in the requested format too.
+			_, err = api.divide(10, 0)
+			if expected := "400 Bad Request: Division by zero is not allowed"; err == nil || err.Error() != expected {
+				t.Errorf("Expected error %q, got %v", expected, err)
+			}
+		})
+	}
+}
+
+func TestDivide_ProblemDetails(t *testing.T) {
+	srv, err := server.New()
+	if err != nil {
+		t.Fatalf("server.New() error: %v", err)
+	}
+	defer srv.Close()
+
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.ErrorResult{Message: "Division by zero is not allowed"})
+	}))
+	defer legacy.Close()
+
+	// A problem without a detail, which is optional.
+	terse := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", server.ProblemContentType)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(server.NewProblem(http.StatusBadRequest, server.CodeDivisionByZero, "", "/divide"))
+	}))
+	defer terse.Close()
+
+	tests := []struct {
+		name            string
+		server          *httptest.Server
+		format          server.Format
+		expectedCode    string
+		expectedMessage string
+	}{
+		{name: "JSON", server: srv.Server, expectedCode: server.CodeDivisionByZero, expectedMessage: "Division by zero is not allowed"},
+		{name: "XML results still get problems", server: srv.Server, format: server.FormatXML, expectedCode: server.CodeDivisionByZero, expectedMessage: "Division by zero is not allowed"},
+		{name: "Legacy server", server: legacy, expectedMessage: "Division by zero is not allowed"},
+		{name: "Problem without a detail", server: terse, expectedCode: server.CodeDivisionByZero, expectedMessage: "Division by zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := API{
+				baseURL: tt.server.URL,
+				client:  tt.server.Client(),
+				format:  tt.format,
+			}
+
+			_, err := api.divide(10, 0)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Expected an *APIError, got %v", err)
+			}
+			if apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != tt.expectedCode {
+				t.Errorf("Expected a 400 with code %q, got %d with code %q", tt.expectedCode, apiErr.StatusCode, apiErr.Code)
+			}
+			if apiErr.Message != tt.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, apiErr.Message)
+			}
+			if expected := "400 Bad Request: " + tt.expectedMessage; err.Error() != expected {
+				t.Errorf("Expected error %q, got %q", expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestDivideBig(t *testing.T) {
+	srv, err := server.New()
+	if err != nil {
+		t.Fatalf("server.New() error: %v", err)
+	}
+	defer srv.Close()
+
+	// A 128-bit audit ID, divided by 2^64 and by a divisor whose remainder fits in a JSON number.
+	auditID, _ := new(big.Int).SetString("-340282366920938463463374607431768211455", 10)
+	tests := []struct {
+		divisor  string
+		expected string
+	}{
+		{divisor: "18446744073709551616", expected: "-18446744073709551615"},
+		{divisor: "9007199254740992", expected: "-9007199254740991"},
+		{divisor: "-5", expected: "0"},
+	}
+
+	for _, format := range []server.Format{server.FormatJSON, server.FormatXML, server.FormatText, server.FormatCBOR} {
+		for _, tt := range tests {
+			t.Run(string(format)+"/"+tt.divisor, func(t *testing.T) {
+				api := API{
+					baseURL: srv.Server.URL,
+					client:  srv.Server.Client(),
+					format:  format,
+				}
+				divisor, _ := new(big.Int).SetString(tt.divisor, 10)
+
+				result, err := api.DivideBig(auditID, divisor)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if result.String() != tt.expected {
+					t.Errorf("Expected result %s, got %s", tt.expected, result)
+				}
+			})
+		}
+	}
+}
+
+func TestNew_WithServerOptions(t *testing.T) {
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg, WithServerOptions(server.WithRateLimit(0.001, 1)))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	if _, err := api.divide(10, 3); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = api.divide(10, 3)
+	if expected := "429 Too Many Requests: Rate limit exceeded"; err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestNew_WithBaseURL(t *testing.T) {
+	// A divide service which isn't the API's to start or stop.
+	remote, err := server.New(server.WithCredentials(server.Credential{Key: "fizzbuzz", Secret: []byte("secret")}))
+	if err != nil {
+		t.Fatalf("server.New() error: %v", err)
+	}
+	defer remote.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg,
+		WithBaseURL(remote.URL+"/"),
+		WithHTTPClient(client),
+		WithCredentials("fizzbuzz", []byte("secret")))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	if api.BaseURL() != remote.URL {
+		t.Errorf("Expected base URL %s, got %s", remote.URL, api.BaseURL())
+	}
+	if api.httpClient() != client {
+		t.Errorf("Expected the supplied client to be used")
+	}
+	if err := api.WaitReady(context.Background()); err != nil {
+		t.Fatalf("Unexpected error waiting for the server: %v", err)
+	}
+	if result, err := api.divide(10, 3); err != nil || result != 1 {
+		t.Fatalf("Expected result 1, got %d and error %v", result, err)
+	}
+
+	// Stopping the API leaves the remote service running.
+	cancel()
+	wg.Wait()
+	resp, err := remote.Client().Get(remote.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Expected the remote service to still be running, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNew_InvalidClientOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		expectedError string
+	}{
+		{
+			name:          "Relative base URL",
+			opts:          []Option{WithBaseURL("divide.example.com")},
+			expectedError: `invalid base URL "divide.example.com": must be an absolute http or https URL`,
+		},
+		{
+			name:          "Unsupported scheme",
+			opts:          []Option{WithBaseURL("ftp://divide.example.com")},
+			expectedError: `invalid base URL "ftp://divide.example.com": must be an absolute http or https URL`,
+		},
+		{
+			name:          "Nil client",
+			opts:          []Option{WithHTTPClient(nil)},
+			expectedError: "http client cannot be nil",
+		},
+		{
+			name:          "Client with transport options",
+			opts:          []Option{WithHTTPClient(&http.Client{}), WithH2C()},
+			expectedError: "an http client cannot be combined with options which configure its transport",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, cancel, err := New(context.Background(), &sync.WaitGroup{}, tt.opts...)
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("Expected error %q, got %v", tt.expectedError, err)
+			}
+			if api != nil || cancel != nil {
+				t.Errorf("Expected no API or cancel function")
+			}
+		})
+	}
+}
+
+func TestNew_WithCredentials(t *testing.T) {
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg, WithCredentials("fizzbuzz", []byte("secret")))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	// Signed requests are accepted, including identical ones which must not look like replays.
+	for range 2 {
+		if result, err := api.divide(10, 3); err != nil || result != 1 {
+			t.Fatalf("Expected result 1, got %d and error %v", result, err)
+		}
+	}
+
+	// Without credentials the same server rejects the request.
+	api.credentials = nil
+	_, err = api.divide(10, 3)
+	if expected := "401 Unauthorized: Missing API key"; err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestNew_MutualTLS(t *testing.T) {
+	pool, clientCert := servertest.NewTestCA(t)
+
+	tests := []struct {
+		name          string
+		opts          []Option
+		expectedError bool
+	}{
+		{
+			name: "With client certificate",
+			opts: []Option{
+				WithServerOptions(server.WithClientCAs(pool)),
+				WithClientCertificate(clientCert),
+			},
+		},
+		{
+			name: "Without client certificate",
+			opts: []Option{
+				WithServerOptions(server.WithClientCAs(pool)),
+			},
+			expectedError: true,
+		},
+		{
+			name: "Server certificate not trusted",
+			opts: []Option{
+				WithServerOptions(server.WithSelfSignedTLS()),
+				WithRootCAs(x509.NewCertPool()),
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wg := sync.WaitGroup{}
+			api, cancel, err := New(context.Background(), &wg, tt.opts...)
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			defer wg.Wait()
+			defer cancel()
+
+			if !strings.HasPrefix(api.baseURL, "https://") {
+				t.Errorf("Expected an https server, got %s", api.baseURL)
+			}
+
+			result, err := api.divide(10, 3)
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("Expected an error, got result %d", result)
+				}
+			} else if err != nil || result != 1 {
+				t.Errorf("Expected result 1, got %d and error %v", result, err)
+			}
+		})
+	}
+}
+
+func TestNew_UnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "divide")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "divide.sock")
+
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg, WithUnixSocket(path), WithServerOptions(server.WithSelfSignedTLS()))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	if result, err := api.divide(10, 3); err != nil || result != 1 {
+		t.Errorf("divide() = %d, %v, expected 1", result, err)
+	}
+	if _, err := os.Lstat(path); err != nil {
+		t.Errorf("Expected the server to be listening on %s: %v", path, err)
+	}
+
+	cancel()
+	wg.Wait()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed when the API stops, got %v", err)
+	}
+}
+
+func TestNew_H2C(t *testing.T) {
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg, WithH2C())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	if result, err := api.divide(10, 3); err != nil || result != 1 {
+		t.Errorf("divide() = %d, %v, expected 1", result, err)
+	}
+
+	resp, err := api.httpClient().Get(api.baseURL + "/healthz")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected the API to use HTTP/2, got %s", resp.Proto)
+	}
+}
+
+// BenchmarkDivide compares parallel divide calls over HTTP/1.1, which needs a connection per
+// concurrent call, with h2c, which multiplexes them over one connection.
+func BenchmarkDivide(b *testing.B) {
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "HTTP/1.1"},
+		{name: "h2c", opts: []Option{WithH2C()}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			wg := sync.WaitGroup{}
+			api, cancel, err := New(context.Background(), &wg, bm.opts...)
+			if err != nil {
+				b.Fatalf("New() error: %v", err)
+			}
+			defer func() {
+				cancel()
+				wg.Wait()
+			}()
+
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if _, err := api.divide(i, 3); err != nil {
+						b.Errorf("divide() error: %v", err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestNew_ServerError(t *testing.T) {
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg, WithServerOptions(server.WithTLSFiles("missing.pem", "missing.key")))
+	if err == nil {
+		cancel()
+		t.Fatalf("Expected an error, got an API %v", api)
+	}
+	if api != nil || cancel != nil {
+		t.Errorf("Expected a nil API and cancel function on error")
+	}
+}
+
+func TestDivide_RequestID(t *testing.T) {
+	var received []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(server.RequestIDHeader))
+		json.NewEncoder(w).Encode(server.DivisionResult{Remainder: server.NewNumber(0)})
+	}))
+	defer mockServer.Close()
+
+	api := API{baseURL: mockServer.URL, client: mockServer.Client()}
+	WithRequestID("run-42")(&api)
+
+	if api.RequestID() != "run-42" {
+		t.Errorf("Expected request ID %q, got %q", "run-42", api.RequestID())
+	}
+
+	api.Fizz(3)
+	api.Buzz(5)
+	if len(received) != 2 || received[0] != "run-42" || received[1] != "run-42" {
+		t.Errorf("Expected both requests to carry the run's request ID, got %v", received)
+	}
+
+	// Without the option every API instance gets its own ID.
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	ids := map[string]bool{}
+	for range 2 {
+		generated, cancel, err := New(context.Background(), &wg)
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		defer cancel()
+		ids[generated.RequestID()] = true
+	}
+	if len(ids) != 2 || ids[""] {
+		t.Errorf("Expected two different generated request IDs, got %v", ids)
+	}
+}
+
+func TestAPI_WaitReady(t *testing.T) {
+	var ready bool
+	var mu sync.Mutex
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path != "/readyz" || !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer mockServer.Close()
+	api := API{baseURL: mockServer.URL, client: mockServer.Client()}
+
+	// A server that never becomes ready times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := api.WaitReady(ctx); err == nil {
+		t.Errorf("Expected an error waiting for a server that isn't ready")
+	}
+
+	// A server that becomes ready is waited for.
+	time.AfterFunc(100*time.Millisecond, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		ready = true
+	})
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := api.WaitReady(ctx); err != nil {
+		t.Errorf("Unexpected error waiting for the server: %v", err)
+	}
+}
+
+func TestNew_WaitReady(t *testing.T) {
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+	if err := api.WaitReady(ctx); err != nil {
+		t.Errorf("Embedded server wasn't ready: %v", err)
+	}
+}
+
+// TestDivide_InjectedFaults drives each of divide's error branches from the real server,
+// using its fault injection rather than hand-written mock servers.
+func TestDivide_InjectedFaults(t *testing.T) {
+	tests := []struct {
+		name                string
+		faults              server.Faults
+		expectedResult      int
+		expectedErrorPrefix string
+	}{
+		{
+			name:                "Server error",
+			faults:              server.Faults{ServerError: 1},
+			expectedErrorPrefix: "500 Internal Server Error: Injected server error",
+		},
+		{
+			name:                "Too many requests",
+			faults:              server.Faults{TooManyRequests: 1},
+			expectedErrorPrefix: "429 Too Many Requests: Injected rate limit",
+		},
+		{
+			name:                "See other",
+			faults:              server.Faults{SeeOther: 1},
+			expectedErrorPrefix: "unexpected status code: 303 See Other: Injected redirect",
+		},
+		{
+			name:                "Malformed JSON",
+			faults:              server.Faults{MalformedJSON: 1},
+			expectedErrorPrefix: "failed to decode result response: ",
+		},
+		{
+			name:                "Oversized body",
+			faults:              server.Faults{OversizedBody: 1},
+			expectedErrorPrefix: "response too large: ",
+		},
+		{
+			name:           "Chunked",
+			faults:         server.Faults{Chunked: 1},
+			expectedResult: 1,
+		},
+		{
+			name:                "Dropped connection",
+			faults:              server.Faults{DropConnection: 1},
+			expectedErrorPrefix: "failed to read response body on response status 200 OK: ",
+		},
+		{
+			name:           "Latency only",
+			faults:         server.Faults{Latency: 10 * time.Millisecond, LatencyProbability: 1},
+			expectedResult: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := server.New(server.WithFaults(tt.faults))
+			if err != nil {
+				t.Fatalf("server.New() error: %v", err)
+			}
+			defer srv.Close()
+
+			api := API{baseURL: srv.URL, client: srv.Client()}
+			result, err := api.divide(10, 3)
+
+			if result != tt.expectedResult {
+				t.Errorf("Expected result %d, got %d", tt.expectedResult, result)
+			}
+			if tt.expectedErrorPrefix == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.HasPrefix(err.Error(), tt.expectedErrorPrefix) {
+				t.Errorf("Expected an error starting %q, got %v", tt.expectedErrorPrefix, err)
+			}
+		})
+	}
+}
+
+func TestDivide_UnknownLength(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxResponse      int64
+		padResponseBytes int
+		expectedResult   int
+		expectedError    string
+	}{
+		{
+			name:           "Small chunked response",
+			expectedResult: 1,
+		},
+		{
+			name:             "Chunked response at the limit",
+			padResponseBytes: maxResponseSize - len(`{"remainder":1}`+"\n"),
+			expectedResult:   1,
+		},
+		{
+			name:             "Chunked response over the limit",
+			padResponseBytes: maxResponseSize - len(`{"remainder":1}`+"\n") + 1,
+			expectedError:    "response too large: more than 1024 bytes",
+		},
+		{
+			name:             "Chunked response over a configured limit",
+			maxResponse:      10,
+			padResponseBytes: 0,
+			expectedError:    "response too large: more than 10 bytes",
+		},
+		{
+			name:             "Chunked response within a configured limit",
+			maxResponse:      4096,
+			padResponseBytes: 2048,
+			expectedResult:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Flushing before writing the body forces a chunked response with no Content-Length.
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				json.NewEncoder(w).Encode(server.DivisionResult{Remainder: server.NewNumber(1)})
+				w.Write([]byte(strings.Repeat(" ", tt.padResponseBytes)))
+			}))
+			defer mockServer.Close()
+
+			api := API{baseURL: mockServer.URL, client: mockServer.Client()}
+			WithMaxResponseSize(tt.maxResponse)(&api)
+
+			result, err := api.divide(ignoredValue, ignoredValue)
+			if result != tt.expectedResult {
+				t.Errorf("Expected result %d, got %d", tt.expectedResult, result)
+			}
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			} else if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("Expected error %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestAPI_Deadlines(t *testing.T) {
+	// A server which takes a second to answer, unless the client gives up first.
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		json.NewEncoder(w).Encode(server.DivisionResult{Remainder: server.NewNumber(0)})
+	}))
+	defer slow.Close()
+
+	t.Run("Context deadline", func(t *testing.T) {
+		api := API{baseURL: slow.URL, client: slow.Client()}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := api.FizzContext(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected a deadline error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("Expected the call to stop at the deadline, took %v", elapsed)
+		}
+	})
+
+	t.Run("Call timeout", func(t *testing.T) {
+		api := API{baseURL: slow.URL, client: slow.Client(), callTimeout: 20 * time.Millisecond}
+		if _, err := api.BuzzContext(context.Background(), 5); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected a deadline error, got %v", err)
+		}
+		// Fizz can't return the error, so it answers false.
+		if api.Fizz(3) {
+			t.Errorf("Expected Fizz to return false after a timeout")
+		}
+	})
+
+	t.Run("Cancellation isn't a server failure", func(t *testing.T) {
+		api := API{baseURL: slow.URL, client: slow.Client(), breaker: newBreaker(BreakerPolicy{FailureThreshold: 1, CoolDown: time.Minute})}
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		if _, err := api.FizzContext(ctx, 3); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected a cancellation error, got %v", err)
+		}
+		if got := api.BreakerState(); got != BreakerClosed {
+			t.Errorf("Expected the breaker to stay closed, got %s", got)
+		}
+	})
+}
+
+func TestDivide_ErrorTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		opts    []Option
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "API error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", server.ProblemContentType)
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(server.NewProblem(http.StatusBadRequest, server.CodeDivisionByZero, "Division by zero is not allowed", "/divide"))
+			},
+			check: func(t *testing.T, err error) {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != server.CodeDivisionByZero {
+					t.Errorf("Expected an *APIError for a division by zero, got %v", err)
+				}
+			},
+		},
+		{
+			name: "Response too large",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(make([]byte, maxResponseSize+1))
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrResponseTooLarge) {
+					t.Errorf("Expected ErrResponseTooLarge, got %v", err)
+				}
+			},
+		},
+		{
+			name: "Unknown length",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.(http.Flusher).Flush()
+				json.NewEncoder(w).Encode(server.DivisionResult{Remainder: server.NewNumber(1)})
+			},
+			opts: []Option{WithRequireContentLength()},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrUnknownLength) {
+					t.Errorf("Expected ErrUnknownLength, got %v", err)
+				}
+			},
+		},
+		{
+			name: "Undecodable result",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("this is not JSON"))
+			},
+			check: func(t *testing.T, err error) {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) || decodeErr.StatusCode != http.StatusOK {
+					t.Errorf("Expected a *DecodeError for a 200, got %v", err)
+				}
+				var syntaxErr *json.SyntaxError
+				if !errors.As(err, &syntaxErr) {
+					t.Errorf("Expected the *json.SyntaxError to be wrapped, got %v", err)
+				}
+			},
+		},
+		{
+			name: "Undecodable problem",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", server.ProblemContentType)
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte("<html>Bad gateway</html>"))
+			},
+			check: func(t *testing.T, err error) {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) || decodeErr.StatusCode != http.StatusBadGateway || !decodeErr.Problem {
+					t.Errorf("Expected a *DecodeError for a 502 problem, got %v", err)
+				}
+			},
+		},
+		{
+			name: "Decompression bomb",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// A few bytes of gzip which decompress to more than the limit.
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(gzipped(t, make([]byte, 100*maxResponseSize)))
+			},
+			opts: []Option{WithCompression()},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrResponseTooLarge) {
+					t.Errorf("Expected ErrResponseTooLarge, got %v", err)
+				}
+			},
+		},
+		{
+			name: "Unsupported encoding",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				w.Write([]byte{0x0b, 0x01, 0x80})
+			},
+			opts: []Option{WithCompression()},
+			check: func(t *testing.T, err error) {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) || !errors.Is(err, server.ErrUnsupportedEncoding) {
+					t.Errorf("Expected a *DecodeError for an unsupported encoding, got %v", err)
+				}
+			},
+		},
+		{
+			name: "Dropped connection",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				conn, _, _ := http.NewResponseController(w).Hijack()
+				conn.Close()
+			},
+			check: func(t *testing.T, err error) {
+				var transportErr *TransportError
+				if !errors.As(err, &transportErr) || transportErr.Status != "" {
+					t.Errorf("Expected a *TransportError without a response, got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(tt.handler)
+			defer mockServer.Close()
+
+			api := API{baseURL: mockServer.URL, client: mockServer.Client()}
+			for _, opt := range tt.opts {
+				opt(&api)
+			}
+
+			_, err := api.divide(ignoredValue, ignoredValue)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			tt.check(t, err)
+		})
+	}
+}
+
+// gzipped returns the data compressed with gzip.
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDivide_Compression(t *testing.T) {
+	body := []byte(`{"remainder":1}`)
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write(body)
+	zw.Close()
+
+	for encoding, compressed := range map[string][]byte{
+		"gzip":    gzipped(t, body),
+		"deflate": deflated.Bytes(),
+		"":        body,
+	} {
+		t.Run(encoding, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != server.AcceptEncoding {
+					t.Errorf("Expected Accept-Encoding %q, got %q", server.AcceptEncoding, got)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if encoding != "" {
+					w.Header().Set("Content-Encoding", encoding)
+				}
+				w.Write(compressed)
+			}))
+			defer mockServer.Close()
+
+			api := API{baseURL: mockServer.URL, client: mockServer.Client()}
+			WithCompression()(&api)
+			if result, err := api.divide(10, 3); err != nil || result != 1 {
+				t.Errorf("Expected result 1, got %d and error %v", result, err)
+			}
+		})
+	}
+}
+
+func TestNew_WithCompression(t *testing.T) {
+	wg := sync.WaitGroup{}
+	api, cancel, err := New(context.Background(), &wg, WithCompression())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer wg.Wait()
+	defer cancel()
+
+	for in := 1; in <= 15; in++ {
+		if got, expected := api.Fizz(in), in%3 == 0; got != expected {
+			t.Errorf("Fizz(%d) = %v, expected %v", in, got, expected)
+		}
+	}
+	if _, err := api.divide(10, 0); err == nil || !strings.Contains(err.Error(), "Division by zero is not allowed") {
+		t.Errorf("Expected a division by zero error, got %v", err)
+	}
+}
+
+func TestDivide_ConnectionRefused(t *testing.T) {
+	// Nothing listens on a closed server's address, so the call fails before there's a response.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	api := API{baseURL: closed.URL, client: closed.Client()}
+	_, err := api.divide(ignoredValue, ignoredValue)
+
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("Expected a *TransportError, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "failed to call API: ") {
+		t.Errorf("Expected the error to start \"failed to call API: \", got %q", err.Error())
+	}
+}
@@ -0,0 +1,201 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures how the API retries calls which fail in ways that might not happen again.
+// Calls are retried after server errors (500, 502, 503 and 504), 429 Too Many Requests and failed
+// connections. Other errors, such as 400 Bad Request for a division by zero, are returned at once.
+type RetryPolicy struct {
+	MaxAttempts int // The most calls made, including the first. 1 or less means no retries.
+
+	// Retries wait for a random time, up to BaseDelay doubled for every retry so far, and never
+	// more than MaxDelay. A Retry-After header on a 429 or 503 replaces the random wait, unless
+	// it's longer than MaxDelay, in which case the call isn't retried.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// The retry budget stops retries from multiplying the load on a struggling server. Every call
+	// adds BudgetRatio to the budget and every retry takes 1 from it, so a ratio of 0.1 allows
+	// retries to add 10% to the calls made. BudgetMin retries are allowed before then, and the
+	// budget never holds more. A BudgetRatio of 0 means there's no budget.
+	BudgetRatio float64
+	BudgetMin   int
+}
+
+// DefaultRetryPolicy returns a policy suitable for the divide server.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		BudgetRatio: 0.2,
+		BudgetMin:   10,
+	}
+}
+
+// WithRetryPolicy makes the API retry failed calls according to the policy.
+// By default calls aren't retried.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(api *API) {
+		api.retrier = newRetrier(policy)
+	}
+}
+
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter returns the wait asked for by a Retry-After header, in seconds or as a date,
+// or zero if there isn't a valid one.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// retryable reports whether a call which failed with err should be retried, and the wait the
+// server asked for.
+func retryable(err error) (bool, time.Duration) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.StatusCode), apiErr.RetryAfter
+	}
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		// The body wasn't understood, perhaps because it came from a proxy, but the status may
+		// say trying again could work.
+		return retryableStatus(decodeErr.StatusCode), decodeErr.RetryAfter
+	}
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		// A caller giving up says nothing about the server.
+		return !errors.Is(err, context.Canceled), 0
+	}
+	return false, 0
+}
+
+// retrier applies a RetryPolicy.
+type retrier struct {
+	policy RetryPolicy
+	sleep  func(ctx context.Context, d time.Duration) error
+
+	mu     sync.Mutex
+	tokens float64 // The retry budget.
+}
+
+func newRetrier(policy RetryPolicy) *retrier {
+	return &retrier{
+		policy: policy,
+		sleep:  sleepContext,
+		tokens: float64(policy.BudgetMin),
+	}
+}
+
+// sleepContext waits for d, or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff returns a random wait before a retry, with full jitter.
+func (r *retrier) backoff(retry int) time.Duration {
+	ceiling := r.policy.MaxDelay
+	if retry < 32 {
+		if d := r.policy.BaseDelay << retry; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// deposit adds a call to the retry budget.
+func (r *retrier) deposit() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = min(r.tokens+r.policy.BudgetRatio, max(float64(r.policy.BudgetMin), 1))
+}
+
+// withdraw takes a retry from the budget, reporting whether there was one to take.
+func (r *retrier) withdraw() bool {
+	if r.policy.BudgetRatio == 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// do calls call, retrying it according to the policy. The last error is returned if every
+// attempt fails, or if the context is done while waiting to retry.
+func (r *retrier) do(ctx context.Context, requestID string, call func() error) error {
+	r.deposit()
+
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= r.policy.MaxAttempts {
+			return err
+		}
+
+		ok, retryAfter := retryable(err)
+		if !ok {
+			return err
+		}
+		delay := r.backoff(attempt - 1)
+		if retryAfter > 0 {
+			if retryAfter > r.policy.MaxDelay {
+				return err
+			}
+			delay = retryAfter
+		}
+		if !r.withdraw() {
+			return err
+		}
+
+		slog.Warn("Retrying divide API call",
+			slog.String("error", err.Error()),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.String("request_id", requestID))
+		if sleepErr := r.sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server"
+)
+
+// recordSleeps replaces the retrier's sleep with one which returns at once, recording the waits.
+func recordSleeps(r *retrier) *[]time.Duration {
+	var mu sync.Mutex
+	var sleeps []time.Duration
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return &sleeps
+}
+
+func TestDivide_Retries(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 2 * time.Second}
+	healthy := divideServer(t)
+	serverError := injectFault(t, server.Faults{ServerError: 1})
+
+	tests := []struct {
+		name           string
+		respond        respondFunc
+		expectedResult int
+		expectedError  string
+		expectedCalls  int32
+		expectedSleeps []time.Duration // Only checked for waits asked for by Retry-After.
+	}{
+		{
+			name:           "Transient server errors",
+			respond:        inTurn(healthy, serverError, withStatus(http.StatusBadGateway, "")),
+			expectedResult: 1,
+			expectedCalls:  3,
+		},
+		{
+			name:           "Dropped connection",
+			respond:        inTurn(healthy, injectFault(t, server.Faults{DropConnection: 1})),
+			expectedResult: 1,
+			expectedCalls:  2,
+		},
+		{
+			name:          "Division by zero is never retried",
+			respond:       withStatus(http.StatusBadRequest, ""),
+			expectedError: "400 Bad Request: Bad Request",
+			expectedCalls: 1,
+		},
+		{
+			name:          "Unauthorized is never retried",
+			respond:       divideServer(t, server.WithCredentials(server.Credential{Key: "key"})),
+			expectedError: "401 Unauthorized: Missing API key",
+			expectedCalls: 1,
+		},
+		{
+			name:           "Too many requests waits for Retry-After",
+			respond:        inTurn(healthy, injectFault(t, server.Faults{TooManyRequests: 1})),
+			expectedResult: 1,
+			expectedCalls:  2,
+			expectedSleeps: []time.Duration{time.Second},
+		},
+		{
+			name:           "Service unavailable waits for Retry-After",
+			respond:        inTurn(healthy, withStatus(http.StatusServiceUnavailable, "2")),
+			expectedResult: 1,
+			expectedCalls:  2,
+			expectedSleeps: []time.Duration{2 * time.Second},
+		},
+		{
+			name:          "Retry-After longer than the maximum delay",
+			respond:       inTurn(healthy, withStatus(http.StatusServiceUnavailable, "60")),
+			expectedError: "unexpected status code: 503 Service Unavailable: Service Unavailable",
+			expectedCalls: 1,
+		},
+		{
+			name:          "Out of attempts",
+			respond:       serverError,
+			expectedError: "500 Internal Server Error: Injected server error",
+			expectedCalls: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t, tt.respond)
+			api := API{baseURL: srv.URL, client: srv.Client(), retrier: newRetrier(policy)}
+			sleeps := recordSleeps(api.retrier)
+
+			result, err := api.divide(10, 3)
+
+			if result != tt.expectedResult {
+				t.Errorf("Expected result %d, got %d", tt.expectedResult, result)
+			}
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			} else if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("Expected error %q, got %v", tt.expectedError, err)
+			}
+			if got := srv.calls.Load(); got != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, got)
+			}
+			for i, expected := range tt.expectedSleeps {
+				if i >= len(*sleeps) || (*sleeps)[i] != expected {
+					t.Errorf("Expected waits %v, got %v", tt.expectedSleeps, *sleeps)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestDivide_RetryBudget(t *testing.T) {
+	// Every call fails, so each would be retried if the budget allowed it.
+	srv := newTestServer(t, injectFault(t, server.Faults{ServerError: 1}))
+
+	policy := RetryPolicy{MaxAttempts: 2, BudgetRatio: 0.5, BudgetMin: 2}
+	api := API{baseURL: srv.URL, client: srv.Client(), retrier: newRetrier(policy)}
+	recordSleeps(api.retrier)
+
+	// The budget starts with 2 retries, and each call adds half a retry, so 10 calls get
+	// 2 retries from the start, then 1 more for every 2 calls after the budget is spent.
+	for range 10 {
+		if _, err := api.divide(10, 3); err == nil {
+			t.Fatal("Expected an error")
+		}
+	}
+	if got, limit := srv.calls.Load(), int32(10+2+5); got > limit {
+		t.Errorf("Expected at most %d calls, got %d", limit, got)
+	}
+	if got := srv.calls.Load(); got < 12 {
+		t.Errorf("Expected at least 12 calls, got %d", got)
+	}
+}
+
+func TestDivide_RetryCancelled(t *testing.T) {
+	srv := newTestServer(t, injectFault(t, server.Faults{ServerError: 1}))
+
+	// The deadline passes while waiting to retry, which gives up with the last error.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	api := API{baseURL: srv.URL, client: srv.Client(), retrier: newRetrier(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})}
+
+	if _, err := api.divideContext(ctx, 10, 3); err == nil || err.Error() != "500 Internal Server Error: Injected server error" {
+		t.Errorf("Expected the server error, got %v", err)
+	}
+	if got := srv.calls.Load(); got != 1 {
+		t.Errorf("Expected 1 call, got %d", got)
+	}
+}
+
+func TestRetrier_Backoff(t *testing.T) {
+	r := newRetrier(RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+
+	for retry, ceiling := range []time.Duration{10, 20, 40, 50, 50} {
+		ceiling *= time.Millisecond
+		for range 100 {
+			if d := r.backoff(retry); d < 0 || d > ceiling {
+				t.Fatalf("Retry %d: expected a delay up to %v, got %v", retry, ceiling, d)
+			}
+		}
+	}
+	// Large retry counts mustn't overflow.
+	if d := r.backoff(100); d < 0 || d > 50*time.Millisecond {
+		t.Errorf("Expected a delay up to the maximum, got %v", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "3", expected: 3 * time.Second},
+		{value: "-3", expected: 0},
+		{value: "soon", expected: 0},
+		{value: now.Add(5 * time.Second).Format(http.TimeFormat), expected: 5 * time.Second},
+		{value: now.Add(-5 * time.Second).Format(http.TimeFormat), expected: 0},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if got := parseRetryAfter(header, now); got != tt.expected {
+			t.Errorf("parseRetryAfter(%q) = %v, expected %v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestNew_WithRetryPolicy(t *testing.T) {
+	var wg sync.WaitGroup
+	// Almost a third of calls fail with an injected server error, which retries hide.
+	api, cancel, err := New(context.Background(), &wg,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 10, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+		WithServerOptions(server.WithFaults(server.Faults{ServerError: 0.3})))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for in := 1; in <= 15; in++ {
+		if got, expected := api.Fizz(in), in%3 == 0; got != expected {
+			t.Errorf("Fizz(%d) = %v, expected %v", in, got, expected)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 signature of a request.
+	SignatureHeader = "X-Signature"
+	// TimestampHeader carries the Unix time, in seconds, at which a request was signed.
+	TimestampHeader = "X-Signature-Timestamp"
+	// NonceHeader carries a random value, unique to each signed request, to prevent replays.
+	NonceHeader = "X-Signature-Nonce"
+
+	// maxClockSkew is how far a signed request's timestamp may be from the server's clock.
+	// Nonces are remembered until their timestamp falls outside this window, after which a
+	// replay would be rejected as stale anyway.
+	maxClockSkew = 5 * time.Minute
+)
+
+// Credential is an API key and, optionally, the secret used to sign requests made with it.
+type Credential struct {
+	Key    string
+	Secret []byte // If empty, requests made with the key don't need to be signed.
+}
+
+// WithCredentials requires requests to present one of the API keys in the X-API-Key header,
+// and to be signed if the key has a secret. Failures are rejected with 401 Unauthorized, or with
+// 403 Forbidden for correctly signed requests that are stale or have been replayed.
+func WithCredentials(creds ...Credential) Option {
+	return func(cfg *config) {
+		cfg.credentials = append(cfg.credentials, creds...)
+	}
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of a request's method, path, query,
+// timestamp and nonce. The query is canonicalised by sorting its parameters.
+func Sign(secret []byte, method, path, rawQuery, timestamp, nonce string) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err == nil {
+		rawQuery = query.Encode()
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, path, rawQuery, timestamp, nonce)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest adds the API key and, if the credential has a secret, the signature headers to r.
+func SignRequest(r *http.Request, cred Credential, now time.Time) error {
+	r.Header.Set(APIKeyHeader, cred.Key)
+	if len(cred.Secret) == 0 {
+		return nil
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(NonceHeader, nonceHex)
+	r.Header.Set(SignatureHeader, Sign(cred.Secret, r.Method, r.URL.Path, r.URL.RawQuery, timestamp, nonceHex))
+	return nil
+}
+
+// nonceCache remembers the nonces of recently accepted requests.
+type nonceCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	sweep   time.Time // When expired nonces should next be removed.
+}
+
+// add records a nonce until expiry. It returns false if the nonce is already known.
+func (nc *nonceCache) add(nonce string, now, expiry time.Time) bool {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if now.After(nc.sweep) {
+		for n, e := range nc.expires {
+			if now.After(e) {
+				delete(nc.expires, n)
+			}
+		}
+		nc.sweep = now.Add(maxClockSkew)
+	}
+
+	if e, ok := nc.expires[nonce]; ok && !now.After(e) {
+		return false
+	}
+	nc.expires[nonce] = expiry
+	return true
+}
+
+// authenticator checks requests against the configured credentials.
+type authenticator struct {
+	secrets  map[string][]byte // API key to secret.
+	nonces   nonceCache
+	failures *rateLimiter // If set, limits the requests each IP address can fail authentication with.
+	now      func() time.Time
+}
+
+func newAuthenticator(creds []Credential) *authenticator {
+	a := &authenticator{
+		secrets: map[string][]byte{},
+		nonces:  nonceCache{expires: map[string]time.Time{}},
+		now:     time.Now,
+	}
+	for _, cred := range creds {
+		a.secrets[cred.Key] = cred.Secret
+	}
+	return a
+}
+
+// check returns the status code and message to reject r with, or 0 if it's authentic.
+func (a *authenticator) check(r *http.Request) (int, string) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return http.StatusUnauthorized, "Missing API key"
+	}
+	secret, ok := a.secrets[key]
+	if !ok {
+		return http.StatusUnauthorized, "Invalid API key"
+	}
+	if len(secret) == 0 {
+		return 0, ""
+	}
+
+	signature := r.Header.Get(SignatureHeader)
+	timestamp := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+	if signature == "" || timestamp == "" || nonce == "" {
+		return http.StatusUnauthorized, "Missing request signature"
+	}
+
+	expected := Sign(secret, r.Method, r.URL.Path, r.URL.RawQuery, timestamp, nonce)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return http.StatusUnauthorized, "Invalid request signature"
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return http.StatusUnauthorized, "Invalid request timestamp"
+	}
+	now := a.now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-maxClockSkew)) || signedAt.After(now.Add(maxClockSkew)) {
+		return http.StatusForbidden, "Request timestamp outside the allowed window"
+	}
+
+	if !a.nonces.add(key+":"+nonce, now, signedAt.Add(maxClockSkew)) {
+		return http.StatusForbidden, "Replayed request"
+	}
+	return 0, ""
+}
+
+type apiKeyKey struct{}
+
+// authenticatedKey returns the API key the request was authenticated with, or "" if it wasn't.
+func authenticatedKey(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyKey{}).(string)
+	return key
+}
+
+// authenticate rejects requests which fail the authenticator's checks. The API keys of the
+// requests it passes on are added to their context.
+func authenticate(a *authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only failures are charged, so clients sharing an address are limited by their own keys.
+		// No key is in the context yet, so the client is identified by IP address.
+		if a.failures != nil {
+			if ok, wait := a.failures.peek(clientID(r)); !ok {
+				w.Header().Set("Retry-After", retryAfterSeconds(wait))
+				writeError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+				return
+			}
+		}
+
+		if statusCode, message := a.check(r); statusCode != 0 {
+			if a.failures != nil {
+				a.failures.allow(clientID(r))
+			}
+			if statusCode == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `HMAC-SHA256 realm="divide"`)
+			}
+			code := CodeUnauthorized
+			if statusCode == http.StatusForbidden {
+				code = CodeForbidden
+			}
+			writeError(w, r, statusCode, code, message)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, r.Header.Get(APIKeyHeader))))
+	})
+}
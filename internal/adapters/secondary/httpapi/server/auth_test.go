@@ -0,0 +1,175 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := []byte("s3cret")
+
+	// sign returns a request signed at the given time, with a fixed nonce.
+	sign := func(key string, secret []byte, signedAt time.Time, nonce string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/divide?b=3&a=10", nil)
+		r.Header.Set(APIKeyHeader, key)
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		r.Header.Set(TimestampHeader, timestamp)
+		r.Header.Set(NonceHeader, nonce)
+		r.Header.Set(SignatureHeader, Sign(secret, r.Method, r.URL.Path, r.URL.RawQuery, timestamp, nonce))
+		return r
+	}
+
+	tests := []struct {
+		name           string
+		request        func() *http.Request
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "Missing API key",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/divide?a=10&b=3", nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"message":"Missing API key"}`,
+		},
+		{
+			name: "Unknown API key",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/divide?a=10&b=3", nil)
+				r.Header.Set(APIKeyHeader, "unknown")
+				return r
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"message":"Invalid API key"}`,
+		},
+		{
+			name: "API key without a secret",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/divide?a=10&b=3", nil)
+				r.Header.Set(APIKeyHeader, "unsigned")
+				return r
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Missing signature",
+			request: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/divide?a=10&b=3", nil)
+				r.Header.Set(APIKeyHeader, "signed")
+				return r
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"message":"Missing request signature"}`,
+		},
+		{
+			name: "Valid signature",
+			request: func() *http.Request {
+				return sign("signed", secret, now, "nonce-1")
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "Replayed nonce",
+			request: func() *http.Request {
+				return sign("signed", secret, now, "nonce-1")
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"message":"Replayed request"}`,
+		},
+		{
+			name: "Wrong secret",
+			request: func() *http.Request {
+				return sign("signed", []byte("guess"), now, "nonce-2")
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"message":"Invalid request signature"}`,
+		},
+		{
+			name: "Tampered query",
+			request: func() *http.Request {
+				r := sign("signed", secret, now, "nonce-3")
+				r.URL.RawQuery = "a=11&b=3"
+				return r
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   `{"message":"Invalid request signature"}`,
+		},
+		{
+			name: "Stale timestamp",
+			request: func() *http.Request {
+				return sign("signed", secret, now.Add(-maxClockSkew-time.Second), "nonce-4")
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"message":"Request timestamp outside the allowed window"}`,
+		},
+		{
+			name: "Future timestamp",
+			request: func() *http.Request {
+				return sign("signed", secret, now.Add(maxClockSkew+time.Second), "nonce-5")
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `{"message":"Request timestamp outside the allowed window"}`,
+		},
+	}
+
+	// The test cases share one authenticator, so that replays can be detected.
+	a := newAuthenticator([]Credential{
+		{Key: "unsigned"},
+		{Key: "signed", Secret: secret},
+	})
+	a.now = func() time.Time { return now }
+	handler := authenticate(a, http.HandlerFunc(handle))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.request())
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedBody != "" && rec.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, rec.Body.String())
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected a WWW-Authenticate header on a 401 response")
+			}
+		})
+	}
+}
+
+func TestNonceCache_Expiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	nc := nonceCache{expires: map[string]time.Time{}}
+
+	if !nc.add("nonce", now, now.Add(time.Minute)) {
+		t.Fatalf("New nonce was refused")
+	}
+	if nc.add("nonce", now.Add(time.Second), now.Add(time.Minute)) {
+		t.Errorf("Repeated nonce was accepted")
+	}
+
+	// Once expired, nonces are swept away.
+	later := now.Add(time.Hour)
+	nc.add("other", later, later.Add(time.Minute))
+	if _, ok := nc.expires["nonce"]; ok {
+		t.Errorf("Expired nonce was not swept")
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/divide?a=10&b=3", nil)
+	if err := SignRequest(r, Credential{Key: "key", Secret: []byte("secret")}, time.Now()); err != nil {
+		t.Fatalf("SignRequest() error: %v", err)
+	}
+
+	a := newAuthenticator([]Credential{{Key: "key", Secret: []byte("secret")}})
+	if statusCode, message := a.check(r); statusCode != 0 {
+		t.Errorf("Signed request was rejected with %d: %s", statusCode, message)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// immutableCacheControl lets any cache keep a result for a year, the longest lifetime RFC 9111
+// suggests, without revalidating it. Results depend only on the request, so they never change.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// etag returns a strong entity tag for a representation. The content type is included, so that
+// each negotiated format of the same result has its own tag.
+func etag(contentType string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(contentType))
+	h.Write([]byte{0})
+	h.Write(body)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches the entity tag.
+// If-None-Match uses weak comparison, so W/ prefixes are ignored.
+func etagMatches(ifNoneMatch, tag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCacheableResult writes a result which depends only on the request, marking it as cacheable
+// forever. Conditional requests for a representation the client already has get a 304.
+func writeCacheableResult(w http.ResponseWriter, r *http.Request, format Format, v any) {
+	body, err := format.Marshal(v)
+	if err != nil {
+		writeResult(w, format, http.StatusOK, v)
+		return
+	}
+
+	tag := etag(format.ContentType(), body)
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", immutableCacheControl)
+	w.Header().Add("Vary", "Accept")
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestServer_Caching(t *testing.T) {
+	server, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	get := func(path string, header http.Header) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response body: %v", err)
+		}
+		return resp, string(body)
+	}
+
+	resp, _ := get("/divide?a=10&b=3", nil)
+	tag := resp.Header.Get("ETag")
+	if tag == "" || tag[0] != '"' {
+		t.Fatalf("Expected a strong ETag, got %q", tag)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != immutableCacheControl {
+		t.Errorf("Expected Cache-Control %q, got %q", immutableCacheControl, got)
+	}
+	if got := resp.Header.Get("Vary"); got != "Accept" {
+		t.Errorf("Expected Vary Accept, got %q", got)
+	}
+
+	// The same result gets the same tag, and other formats and results get their own.
+	if resp, _ := get("/divide?a=10&b=3", nil); resp.Header.Get("ETag") != tag {
+		t.Errorf("Expected a repeated request to get ETag %s, got %s", tag, resp.Header.Get("ETag"))
+	}
+	if resp, _ := get("/divide?a=10&b=3", http.Header{"Accept": {"application/xml"}}); resp.Header.Get("ETag") == tag {
+		t.Errorf("Expected XML to get a different ETag to JSON")
+	}
+	if resp, _ := get("/divide?a=11&b=3", nil); resp.Header.Get("ETag") == tag {
+		t.Errorf("Expected a different result to get a different ETag")
+	}
+
+	tests := []struct {
+		name           string
+		ifNoneMatch    string
+		expectedStatus int
+	}{
+		{name: "Matching tag", ifNoneMatch: tag, expectedStatus: http.StatusNotModified},
+		{name: "Weak form of the tag", ifNoneMatch: "W/" + tag, expectedStatus: http.StatusNotModified},
+		{name: "Tag in a list", ifNoneMatch: `"other", ` + tag, expectedStatus: http.StatusNotModified},
+		{name: "Any tag", ifNoneMatch: "*", expectedStatus: http.StatusNotModified},
+		{name: "Other tag", ifNoneMatch: `"other"`, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get("/divide?a=10&b=3", http.Header{"If-None-Match": {tt.ifNoneMatch}})
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if resp.StatusCode == http.StatusNotModified && (body != "" || resp.Header.Get("ETag") != tag) {
+				t.Errorf("Expected an empty 304 with ETag %s, got %q with ETag %s", tag, body, resp.Header.Get("ETag"))
+			}
+		})
+	}
+
+	// Errors aren't marked as cacheable.
+	if resp, _ := get("/divide?a=10&b=0", nil); resp.Header.Get("ETag") != "" || resp.Header.Get("Cache-Control") != "" {
+		t.Errorf("Expected an error without caching headers, got ETag %q and Cache-Control %q",
+			resp.Header.Get("ETag"), resp.Header.Get("Cache-Control"))
+	}
+}
@@ -0,0 +1,443 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// A minimal CBOR (RFC 8949) codec, covering just enough of the format to carry the server's
+// result types: integers, booleans, null, byte and text strings, arrays and maps.
+// Structs are encoded as maps keyed by their json field names, and Numbers too large for a
+// CBOR integer as bignums.
+
+// CBOR major types.
+const (
+	cborUnsigned byte = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// CBOR simple values.
+const (
+	cborFalse byte = 0xf4
+	cborTrue  byte = 0xf5
+	cborNull  byte = 0xf6
+)
+
+// CBOR tags for bignums, whose content is a byte string holding the big-endian magnitude.
+const (
+	cborPositiveBignum = 2
+	cborNegativeBignum = 3 // The value is -1 minus the magnitude.
+)
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+var numberType = reflect.TypeFor[Number]()
+
+// cborMarshal encodes v as CBOR.
+func cborMarshal(v any) ([]byte, error) {
+	return cborEncode(nil, reflect.ValueOf(v))
+}
+
+// cborAppendHead appends an item header for the major type and argument.
+func cborAppendHead(buf []byte, major byte, arg uint64) []byte {
+	m := major << 5
+	switch {
+	case arg < 24:
+		return append(buf, m|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(buf, m|24, byte(arg))
+	case arg <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, m|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, m|26), uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, m|27), arg)
+	}
+}
+
+func cborEncode(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, cborNull), nil
+	}
+	if v.Type() == numberType {
+		return cborAppendNumber(buf, v.Interface().(Number)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, cborNull), nil
+		}
+		return cborEncode(buf, v.Elem())
+
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, cborTrue), nil
+		}
+		return append(buf, cborFalse), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		if n < 0 {
+			// Negative integers are encoded as -1 - n.
+			return cborAppendHead(buf, cborNegative, uint64(-(n + 1))), nil
+		}
+		return cborAppendHead(buf, cborUnsigned, uint64(n)), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cborAppendHead(buf, cborUnsigned, v.Uint()), nil
+
+	case reflect.String:
+		buf = cborAppendHead(buf, cborText, uint64(v.Len()))
+		return append(buf, v.String()...), nil
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			buf = cborAppendHead(buf, cborBytes, uint64(v.Len()))
+			return append(buf, v.Bytes()...), nil
+		}
+		buf = cborAppendHead(buf, cborArray, uint64(v.Len()))
+		var err error
+		for i := range v.Len() {
+			if buf, err = cborEncode(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+
+	case reflect.Struct:
+		var fields []field
+		for _, f := range fieldsOf(v.Type()) {
+			if f.omitEmpty && v.Field(f.index).IsZero() {
+				continue
+			}
+			fields = append(fields, f)
+		}
+		buf = cborAppendHead(buf, cborMap, uint64(len(fields)))
+		var err error
+		for _, f := range fields {
+			buf = cborAppendHead(buf, cborText, uint64(len(f.name)))
+			buf = append(buf, f.name...)
+			if buf, err = cborEncode(buf, v.Field(f.index)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+
+	default:
+		return nil, fmt.Errorf("cbor: cannot marshal %s", v.Type())
+	}
+}
+
+// cborAppendNumber appends n as an integer if it fits in one, and as a bignum otherwise.
+func cborAppendNumber(buf []byte, n Number) []byte {
+	major, tag := cborUnsigned, uint64(cborPositiveBignum)
+	magnitude := n.Big()
+	if magnitude.Sign() < 0 {
+		major, tag = cborNegative, cborNegativeBignum
+		magnitude.Not(magnitude) // -1 - n, as for negative integers.
+	}
+	if magnitude.IsUint64() {
+		return cborAppendHead(buf, major, magnitude.Uint64())
+	}
+	b := magnitude.Bytes()
+	buf = cborAppendHead(buf, cborTag, tag)
+	buf = cborAppendHead(buf, cborBytes, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// cborUnmarshal decodes CBOR data into the value pointed to by v.
+func cborUnmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cbor: cannot unmarshal into %T", v)
+	}
+	d := cborDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.off != len(d.data) {
+		return fmt.Errorf("cbor: %d trailing bytes after top-level item", len(d.data)-d.off)
+	}
+	return nil
+}
+
+type cborDecoder struct {
+	data []byte
+	off  int
+}
+
+// head reads an item header, returning its major type and argument.
+// For simple values the argument is the full initial byte.
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.off >= len(d.data) {
+		return 0, 0, errCBORTruncated
+	}
+	initial := d.data[d.off]
+	d.off++
+	major, info := initial>>5, initial&0x1f
+
+	if major == cborSimple {
+		return major, uint64(initial), nil
+	}
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+
+	if len(d.data)-d.off < size {
+		return 0, 0, errCBORTruncated
+	}
+	var arg uint64
+	for _, b := range d.data[d.off : d.off+size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.off += size
+	return major, arg, nil
+}
+
+// bytes reads n bytes of string content.
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if uint64(len(d.data)-d.off) < n {
+		return nil, errCBORTruncated
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+// skip reads and discards one complete item.
+func (d *cborDecoder) skip() error {
+	major, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborBytes, cborText:
+		_, err = d.bytes(arg)
+		return err
+	case cborArray:
+		for range arg {
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	case cborMap:
+		for range 2 * arg {
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	case cborTag:
+		return d.skip()
+	case cborSimple:
+		// Extended simple values and floats carry a payload after the initial byte.
+		if info := byte(arg) & 0x1f; info >= 24 && info <= 27 {
+			_, err = d.bytes(1 << (info - 24))
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *cborDecoder) decode(v reflect.Value) error {
+	start := d.off
+	major, arg, err := d.head()
+	if err != nil {
+		return err
+	}
+
+	if major == cborSimple && byte(arg) == cborNull {
+		v.SetZero()
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		d.off = start
+		return d.decode(v.Elem())
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("cbor: cannot unmarshal major type %d into %s", major, v.Type())
+	}
+
+	if v.Type() == numberType {
+		n, err := d.number(major, arg)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(NewBigNumber(n)))
+		return nil
+	}
+
+	switch major {
+	case cborUnsigned, cborNegative:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if arg > math.MaxInt64 {
+				return fmt.Errorf("cbor: integer overflows %s", v.Type())
+			}
+			n := int64(arg)
+			if major == cborNegative {
+				n = -1 - n
+			}
+			if v.OverflowInt(n) {
+				return fmt.Errorf("cbor: integer overflows %s", v.Type())
+			}
+			v.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if major == cborNegative || v.OverflowUint(arg) {
+				return fmt.Errorf("cbor: integer overflows %s", v.Type())
+			}
+			v.SetUint(arg)
+		default:
+			return mismatch()
+		}
+
+	case cborBytes:
+		b, err := d.bytes(arg)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 {
+			return mismatch()
+		}
+		v.SetBytes(append([]byte(nil), b...))
+
+	case cborText:
+		b, err := d.bytes(arg)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.String {
+			return mismatch()
+		}
+		v.SetString(string(b))
+
+	case cborArray:
+		if v.Kind() != reflect.Slice {
+			return mismatch()
+		}
+		if arg > uint64(len(d.data)-d.off) {
+			// Every element takes at least one byte.
+			return errCBORTruncated
+		}
+		s := reflect.MakeSlice(v.Type(), int(arg), int(arg))
+		for i := range int(arg) {
+			if err := d.decode(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+
+	case cborMap:
+		if v.Kind() != reflect.Struct {
+			return mismatch()
+		}
+		byName := map[string]field{}
+		for _, f := range fieldsOf(v.Type()) {
+			byName[f.name] = f
+		}
+		for range arg {
+			keyMajor, keyLen, err := d.head()
+			if err != nil {
+				return err
+			}
+			if keyMajor != cborText {
+				return fmt.Errorf("cbor: unsupported map key of major type %d", keyMajor)
+			}
+			key, err := d.bytes(keyLen)
+			if err != nil {
+				return err
+			}
+			f, ok := byName[string(key)]
+			if !ok {
+				if err := d.skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+
+	case cborSimple:
+		if v.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		switch byte(arg) {
+		case cborTrue:
+			v.SetBool(true)
+		case cborFalse:
+			v.SetBool(false)
+		default:
+			return fmt.Errorf("cbor: unsupported simple value 0x%x", arg)
+		}
+
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// number decodes an integer or bignum, whose header has already been read.
+func (d *cborDecoder) number(major byte, arg uint64) (*big.Int, error) {
+	n := new(big.Int)
+	switch major {
+	case cborUnsigned:
+		return n.SetUint64(arg), nil
+	case cborNegative:
+		return n.Not(n.SetUint64(arg)), nil
+	case cborTag:
+		if arg != cborPositiveBignum && arg != cborNegativeBignum {
+			return nil, fmt.Errorf("cbor: unsupported tag %d", arg)
+		}
+		contentMajor, length, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if contentMajor != cborBytes {
+			return nil, fmt.Errorf("cbor: bignum content of major type %d", contentMajor)
+		}
+		b, err := d.bytes(length)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > maxNumberDigits/2 {
+			// A byte holds about 2.4 decimal digits, so this is a little more generous than ParseNumber.
+			return nil, fmt.Errorf("cbor: bignum of %d bytes is too large", len(b))
+		}
+		n.SetBytes(b)
+		if arg == cborNegativeBignum {
+			n.Not(n)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("cbor: cannot unmarshal major type %d into %s", major, numberType)
+	}
+}
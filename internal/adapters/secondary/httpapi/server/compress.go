@@ -0,0 +1,227 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultCompressionMinSize is the smallest response body compressed by default. Smaller
+	// bodies would barely shrink, or even grow, once the encoding's header is added.
+	DefaultCompressionMinSize = 256
+
+	// AcceptEncoding lists the content codings the server compresses with, best first, for use
+	// in Accept-Encoding headers.
+	AcceptEncoding = "gzip, deflate"
+)
+
+// ErrUnsupportedEncoding is returned by Decompress for content codings other than gzip and deflate.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// WithCompression makes the server compress response bodies of at least minSize bytes with gzip
+// or deflate, whichever the client's Accept-Encoding prefers, and accept request bodies
+// compressed with either. The request body size limits apply to the decompressed bodies.
+func WithCompression(minSize int) Option {
+	return func(cfg *config) {
+		cfg.compress = true
+		cfg.compressMinSize = minSize
+	}
+}
+
+// Decompress returns a reader of the body decompressed according to its Content-Encoding.
+// Bodies without an encoding, or with identity, are returned as they are.
+func Decompress(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// HTTP's deflate is the zlib format, not raw DEFLATE.
+		return zlib.NewReader(body)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// negotiateEncoding returns the content coding to compress a response with, gzip or deflate, or ""
+// if the Accept-Encoding header allows neither. Ties go to gzip.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		quality, ok := qualities[coding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = coding, quality
+		}
+	}
+	return best
+}
+
+// compressWriter buffers a response until it reaches the minimum size, then compresses the rest
+// of it as it's written. Smaller responses are written as they are once the handler returns.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string // The negotiated coding, or "" if the client accepts neither.
+	minSize  int
+
+	status  int
+	buf     []byte
+	started bool       // Whether the status and headers have been written.
+	enc     compressor // Set once the response is being compressed.
+}
+
+// compressor is a gzip or zlib writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.status == 0 {
+		cw.status = statusCode
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.started {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) < cw.minSize {
+		return len(b), nil
+	}
+	if err := cw.start(cw.compressible()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush sends what's been written so far. A response which hasn't reached the minimum size is
+// sent uncompressed, as the handler is streaming it and its size is unknown.
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if cw.start(false) != nil {
+			return
+		}
+	}
+	if cw.enc != nil && cw.enc.Flush() != nil {
+		return
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible reports whether the response can be compressed.
+func (cw *compressWriter) compressible() bool {
+	return cw.encoding != "" && cw.Header().Get("Content-Encoding") == "" &&
+		cw.status != http.StatusNoContent && cw.status != http.StatusNotModified
+}
+
+// start writes the status, headers and buffered body, compressing them if compress is true.
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+	if !compress {
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(cw.buf)
+		return err
+	}
+
+	h := cw.Header()
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	// The compressed bytes differ, so a strong tag no longer holds. Conditional requests use weak
+	// comparison, so clients can still revalidate with it.
+	if tag := h.Get("ETag"); tag != "" && !strings.HasPrefix(tag, "W/") {
+		h.Set("ETag", "W/"+tag)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if cw.encoding == "gzip" {
+		cw.enc = gzip.NewWriter(cw.ResponseWriter)
+	} else {
+		cw.enc = zlib.NewWriter(cw.ResponseWriter)
+	}
+	_, err := cw.enc.Write(cw.buf)
+	return err
+}
+
+// close finishes the response once the handler has returned.
+func (cw *compressWriter) close() {
+	switch {
+	case cw.enc != nil:
+		cw.enc.Close()
+	case !cw.started && cw.status != 0:
+		// The response was too small to compress.
+		cw.start(false)
+	}
+}
+
+// compress compresses responses of at least minSize bytes according to the request's
+// Accept-Encoding, and decompresses request bodies according to their Content-Encoding.
+func compress(minSize int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on Accept-Encoding, whether or not this one is compressed.
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+			body, err := Decompress(encoding, r.Body)
+			if errors.Is(err, ErrUnsupportedEncoding) {
+				// RFC 7694 asks for the codings which are supported.
+				w.Header().Set("Accept-Encoding", AcceptEncoding)
+				writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedEncoding, "Unsupported content encoding")
+				return
+			}
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidBody, "Invalid compressed body")
+				return
+			}
+			defer body.Close()
+			r.Body = body
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: negotiateEncoding(r.Header.Get("Accept-Encoding")), minSize: minSize}
+		next.ServeHTTP(cw, r)
+		// Not deferred, so that after a panic nothing has been written and the 500 can be.
+		cw.close()
+	})
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// classifyRangeBody is a JSON-RPC request whose response is large enough to compress.
+const classifyRangeBody = `{"jsonrpc":"2.0","method":"classifyRange","params":[1,100],"id":1}`
+
+func TestServer_Compression(t *testing.T) {
+	server, err := New(WithCompression(DefaultCompressionMinSize))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		name             string
+		path             string
+		acceptEncoding   string
+		expectedEncoding string
+	}{
+		{
+			name:             "gzip",
+			path:             "/rpc",
+			acceptEncoding:   "gzip",
+			expectedEncoding: "gzip",
+		},
+		{
+			name:             "deflate",
+			path:             "/rpc",
+			acceptEncoding:   "deflate",
+			expectedEncoding: "deflate",
+		},
+		{
+			name:             "gzip preferred",
+			path:             "/rpc",
+			acceptEncoding:   "deflate, gzip",
+			expectedEncoding: "gzip",
+		},
+		{
+			name:             "gzip refused",
+			path:             "/rpc",
+			acceptEncoding:   "gzip;q=0, *",
+			expectedEncoding: "deflate",
+		},
+		{
+			name:           "Unsupported encoding",
+			path:           "/rpc",
+			acceptEncoding: "br",
+		},
+		{
+			name: "No Accept-Encoding",
+			path: "/rpc",
+		},
+		{
+			name:           "Too small to compress",
+			path:           "/divide?a=10&b=3",
+			acceptEncoding: "gzip",
+		},
+	}
+
+	// Without compression, for comparison with the decompressed bodies.
+	resp, err := server.Client().Post(server.URL+"/rpc", "application/json", strings.NewReader(classifyRangeBody))
+	if err != nil {
+		t.Fatalf("Failed to call server: %v", err)
+	}
+	expectedRPC, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, body := http.MethodGet, io.Reader(nil)
+			if tt.path == "/rpc" {
+				method, body = http.MethodPost, strings.NewReader(classifyRangeBody)
+			}
+			req, _ := http.NewRequest(method, server.URL+tt.path, body)
+			req.Header.Set("Content-Type", "application/json")
+			// Setting Accept-Encoding stops the transport decompressing responses itself.
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			if tt.acceptEncoding == "" {
+				req.Header.Set("Accept-Encoding", "identity")
+			}
+
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Failed to call server: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", tt.expectedEncoding, got)
+			}
+			if got := resp.Header.Values("Vary"); !strings.Contains(strings.Join(got, ","), "Accept-Encoding") {
+				t.Errorf("Expected Vary to include Accept-Encoding, got %v", got)
+			}
+
+			decoded, err := Decompress(resp.Header.Get("Content-Encoding"), resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to decompress response: %v", err)
+			}
+			got, err := io.ReadAll(decoded)
+			if err != nil {
+				t.Fatalf("Failed to read response: %v", err)
+			}
+			expected := string(expectedRPC)
+			if tt.path != "/rpc" {
+				expected = `{"remainder":1}`
+			}
+			if string(got) != expected {
+				t.Errorf("Expected body %q, got %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestServer_CompressionETag(t *testing.T) {
+	// Every response is compressed, however small.
+	server, err := New(WithCompression(0))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	get := func(ifNoneMatch string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/divide?a=10&b=3", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Failed to call server: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// The compressed representation's tag is weak.
+	resp := get("")
+	tag := resp.Header.Get("ETag")
+	if resp.Header.Get("Content-Encoding") != "gzip" || !strings.HasPrefix(tag, `W/"`) {
+		t.Fatalf("Expected a gzipped response with a weak ETag, got %q and %q", resp.Header.Get("Content-Encoding"), tag)
+	}
+
+	// It still revalidates, and the 304 has no body to compress.
+	resp = get(tag)
+	if resp.StatusCode != http.StatusNotModified || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Expected an uncompressed 304, got %d with encoding %q", resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestServer_CompressedRequest(t *testing.T) {
+	server, err := New(WithCompression(DefaultCompressionMinSize))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(`{"jsonrpc":"2.0","method":"divide","params":[10,3],"id":1}`))
+	zw.Close()
+
+	// A gzip bomb, which decompresses to more than the JSON-RPC body limit.
+	var bomb bytes.Buffer
+	zw = gzip.NewWriter(&bomb)
+	zw.Write(bytes.Repeat([]byte(" "), maxRPCBodySize+1))
+	zw.Close()
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		expectedStatus  int
+		expectedBody    string
+	}{
+		{
+			name:            "gzip",
+			contentEncoding: "gzip",
+			body:            gzipped.Bytes(),
+			expectedStatus:  http.StatusOK,
+			expectedBody:    `{"jsonrpc":"2.0","result":{"remainder":1},"id":1}`,
+		},
+		{
+			name:            "Unsupported encoding",
+			contentEncoding: "br",
+			body:            gzipped.Bytes(),
+			expectedStatus:  http.StatusUnsupportedMediaType,
+			expectedBody:    `{"message":"Unsupported content encoding"}`,
+		},
+		{
+			name:            "Invalid gzip",
+			contentEncoding: "gzip",
+			body:            []byte("not gzip"),
+			expectedStatus:  http.StatusBadRequest,
+			expectedBody:    `{"message":"Invalid compressed body"}`,
+		},
+		{
+			name:            "Too large once decompressed",
+			contentEncoding: "gzip",
+			body:            bomb.Bytes(),
+			expectedStatus:  http.StatusRequestEntityTooLarge,
+			expectedBody:    `{"message":"Request body too large"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/rpc", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", tt.contentEncoding)
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Failed to call server: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if strings.TrimSpace(string(body)) != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, body)
+			}
+			if tt.expectedStatus == http.StatusUnsupportedMediaType && resp.Header.Get("Accept-Encoding") != AcceptEncoding {
+				t.Errorf("Expected Accept-Encoding %q, got %q", AcceptEncoding, resp.Header.Get("Accept-Encoding"))
+			}
+		})
+	}
+}
+
+func TestCompressWriter_Flush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	cw := &compressWriter{ResponseWriter: rec, encoding: "gzip", minSize: 10}
+
+	// Once compressing, a flush sends everything written so far through the encoder.
+	written := strings.Repeat("fizzbuzz", 4)
+	cw.Write([]byte(written))
+	if err := http.NewResponseController(cw).Flush(); err != nil {
+		t.Fatalf("Flush() error: %v", err)
+	}
+	if !rec.Flushed || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a flushed gzip response, got flushed %v and encoding %q", rec.Flushed, rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decompress response: %v", err)
+	}
+	got := make([]byte, len(written))
+	if _, err := io.ReadFull(zr, got); err != nil || string(got) != written {
+		t.Errorf("Expected %q to have been sent, got %q and error %v", written, got, err)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for acceptEncoding, expected := range map[string]string{
+		"":                      "",
+		"gzip":                  "gzip",
+		"GZIP":                  "gzip",
+		"deflate":               "deflate",
+		"gzip, deflate":         "gzip",
+		"gzip;q=0.5, deflate":   "deflate",
+		"gzip;q=0, deflate;q=0": "",
+		"*":                     "gzip",
+		"*;q=0":                 "",
+		"br, identity":          "",
+		"gzip;q=bad, deflate":   "deflate",
+	} {
+		if got := negotiateEncoding(acceptEncoding); got != expected {
+			t.Errorf("negotiateEncoding(%q) = %q, expected %q", acceptEncoding, got, expected)
+		}
+	}
+}
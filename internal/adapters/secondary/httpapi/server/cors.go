@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsMaxAge is how long browsers may cache the result of a preflight request.
+const corsMaxAge = 10 * time.Minute
+
+// corsAllowedHeaders are the request headers browsers may send in cross-origin requests.
+var corsAllowedHeaders = []string{
+	"Accept",
+	"Content-Encoding",
+	"Content-Type",
+	"If-None-Match",
+	APIKeyHeader,
+	RequestIDHeader,
+	SignatureHeader,
+	TimestampHeader,
+	NonceHeader,
+}
+
+// corsExposedHeaders are the response headers browsers let cross-origin scripts read.
+var corsExposedHeaders = []string{
+	RequestIDHeader,
+	"Retry-After",
+	"ETag",
+}
+
+// WithCORSOrigins allows browser scripts from the origins, such as "https://dashboard.example.com",
+// to call the server. An origin of "*" allows any origin.
+func WithCORSOrigins(origins ...string) Option {
+	return func(cfg *config) {
+		cfg.corsOrigins = append(cfg.corsOrigins, origins...)
+	}
+}
+
+// cors adds CORS headers to responses for allowed origins, and answers preflight requests.
+// Preflights are answered before authentication, since browsers don't send credentials with them.
+func cors(origins []string, next http.Handler) http.Handler {
+	anyOrigin := slices.Contains(origins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+
+		allowed := anyOrigin || slices.Contains(origins, origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !preflight {
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Origin", allowOrigin(anyOrigin, origin))
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		methods, ok := routeMethods[r.URL.Path]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !allowed {
+			writeError(w, r, http.StatusForbidden, CodeOriginNotAllowed, "Origin not allowed")
+			return
+		}
+		if !slices.Contains(methods, r.Header.Get("Access-Control-Request-Method")) {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method Not Allowed")
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin(anyOrigin, origin))
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for an allowed origin.
+func allowOrigin(anyOrigin bool, origin string) string {
+	if anyOrigin {
+		return "*"
+	}
+	return origin
+}
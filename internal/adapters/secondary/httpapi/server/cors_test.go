@@ -0,0 +1,133 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestServer_CORS(t *testing.T) {
+	const dashboard = "https://dashboard.example.com"
+
+	tests := []struct {
+		name                string
+		origins             []string
+		method              string
+		headers             map[string]string
+		expectedStatus      int
+		expectedAllowOrigin string
+		expectAllowMethods  bool
+	}{
+		{
+			name:                "Simple request from an allowed origin",
+			origins:             []string{dashboard},
+			method:              http.MethodGet,
+			headers:             map[string]string{"Origin": dashboard},
+			expectedStatus:      http.StatusOK,
+			expectedAllowOrigin: dashboard,
+		},
+		{
+			name:           "Simple request from another origin",
+			origins:        []string{dashboard},
+			method:         http.MethodGet,
+			headers:        map[string]string{"Origin": "https://evil.example.com"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:                "Any origin",
+			origins:             []string{"*"},
+			method:              http.MethodGet,
+			headers:             map[string]string{"Origin": "https://anywhere.example.com"},
+			expectedStatus:      http.StatusOK,
+			expectedAllowOrigin: "*",
+		},
+		{
+			name:    "Preflight from an allowed origin",
+			origins: []string{dashboard},
+			method:  http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         dashboard,
+				"Access-Control-Request-Method":  http.MethodGet,
+				"Access-Control-Request-Headers": "x-api-key",
+			},
+			expectedStatus:      http.StatusNoContent,
+			expectedAllowOrigin: dashboard,
+			expectAllowMethods:  true,
+		},
+		{
+			name:    "Preflight from another origin",
+			origins: []string{dashboard},
+			method:  http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": http.MethodGet,
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:    "Preflight for a method that isn't allowed",
+			origins: []string{dashboard},
+			method:  http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        dashboard,
+				"Access-Control-Request-Method": http.MethodDelete,
+			},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:    "Preflight with CORS disabled",
+			origins: nil,
+			method:  http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        dashboard,
+				"Access-Control-Request-Method": http.MethodGet,
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Preflights must succeed without credentials.
+			opts := []Option{WithCredentials(Credential{Key: "key"})}
+			if tt.origins != nil {
+				opts = append(opts, WithCORSOrigins(tt.origins...))
+			}
+			server, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			defer server.Close()
+
+			req, err := http.NewRequest(tt.method, server.URL+"/divide?a=10&b=3", nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set(APIKeyHeader, "key")
+			if tt.method == http.MethodOptions {
+				req.Header.Del(APIKeyHeader)
+			}
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.expectedAllowOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.expectedAllowOrigin, got)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Methods"); (got != "") != tt.expectAllowMethods {
+				t.Errorf("Unexpected Access-Control-Allow-Methods %q", got)
+			}
+			if tt.origins != nil && resp.Header.Get("Vary") == "" {
+				t.Errorf("Expected a Vary header")
+			}
+		})
+	}
+}
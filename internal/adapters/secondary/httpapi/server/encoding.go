@@ -0,0 +1,304 @@
+package server
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Format is a media type the server can encode its results in.
+type Format string
+
+const (
+	FormatJSON Format = "application/json"
+	FormatXML  Format = "application/xml"
+	FormatText Format = "text/plain"
+	FormatCBOR Format = "application/cbor"
+)
+
+// formats lists the supported formats in the server's order of preference,
+// which is used to break ties when a client accepts several equally.
+var formats = []Format{FormatJSON, FormatXML, FormatText, FormatCBOR}
+
+// ContentType returns the value to use in a Content-Type header for the format.
+func (f Format) ContentType() string {
+	if f == FormatText {
+		return "text/plain; charset=utf-8"
+	}
+	return string(f)
+}
+
+// Marshal encodes v in the format.
+func (f Format) Marshal(v any) ([]byte, error) {
+	switch f {
+	case FormatJSON:
+		return json.Marshal(v)
+	case FormatXML:
+		return xml.Marshal(v)
+	case FormatText:
+		return textMarshal(v)
+	case FormatCBOR:
+		return cborMarshal(v)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", f)
+	}
+}
+
+// Unmarshal decodes data in the format into the value pointed to by v.
+func (f Format) Unmarshal(data []byte, v any) error {
+	switch f {
+	case FormatJSON:
+		return json.Unmarshal(data, v)
+	case FormatXML:
+		return xml.Unmarshal(data, v)
+	case FormatText:
+		return textUnmarshal(data, v)
+	case FormatCBOR:
+		return cborUnmarshal(data, v)
+	default:
+		return fmt.Errorf("unsupported format %q", f)
+	}
+}
+
+// ParseFormat returns the Format for a Content-Type header value.
+func ParseFormat(contentType string) (Format, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+	if mediaType == "text/xml" {
+		return FormatXML, nil
+	}
+	for _, f := range formats {
+		if mediaType == string(f) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported content type %q", mediaType)
+}
+
+// Negotiate picks the best supported format for an Accept header value.
+// An empty header accepts anything, so the server's preferred format is used.
+// It returns false if none of the supported formats are acceptable.
+func Negotiate(accept string) (Format, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formats[0], true
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQuality := Format(""), 0.0
+	for _, f := range formats {
+		if quality := ranges.quality(string(f)); quality > bestQuality {
+			best, bestQuality = f, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// mediaRange is one entry of an Accept header.
+type mediaRange struct {
+	typ, subtype string
+	quality      float64
+}
+
+// mediaRanges are the entries of an Accept header.
+type mediaRanges []mediaRange
+
+// parseAccept parses an Accept header value, skipping malformed entries.
+func parseAccept(accept string) mediaRanges {
+	var ranges mediaRanges
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, quality: quality})
+	}
+	return ranges
+}
+
+// quality returns how acceptable the media type is, from 0 for not at all to 1.
+// The most specific matching range decides the quality.
+func (ranges mediaRanges) quality(mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+
+	quality, specificity := 0.0, -1
+	for _, mr := range ranges {
+		var s int
+		switch {
+		case mr.typ == typ && mr.subtype == subtype:
+			s = 2
+		case mr.typ == typ && mr.subtype == "*":
+			s = 1
+		case mr.typ == "*" && mr.subtype == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			quality, specificity = mr.quality, s
+		}
+	}
+	return quality
+}
+
+// names reports whether one of the ranges names the media type itself, rather than matching it
+// with a wildcard.
+func (ranges mediaRanges) names(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	for _, mr := range ranges {
+		if mr.typ == typ && mr.subtype == subtype {
+			return true
+		}
+	}
+	return false
+}
+
+// field describes an exported struct field and the name it is encoded under,
+// taken from its json tag so that every format uses the same names.
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// fieldsOf returns the encodable fields of the struct type t.
+func fieldsOf(t reflect.Type) []field {
+	var fields []field
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{
+			name:      name,
+			index:     i,
+			omitEmpty: strings.Contains(opts, "omitempty"),
+		})
+	}
+	return fields
+}
+
+// textMarshal encodes a struct as one "name=value" line per field.
+func textMarshal(v any) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("text: cannot marshal %s", rv.Type())
+	}
+
+	var sb strings.Builder
+	for _, f := range fieldsOf(rv.Type()) {
+		fv := rv.Field(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		var value string
+		if m, ok := fv.Interface().(encoding.TextMarshaler); ok {
+			text, err := m.MarshalText()
+			if err != nil {
+				return nil, fmt.Errorf("text: field %s: %w", f.name, err)
+			}
+			fmt.Fprintf(&sb, "%s=%s\n", f.name, text)
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.String:
+			value = fv.String()
+			if strings.ContainsAny(value, "\r\n") {
+				return nil, fmt.Errorf("text: field %s contains a line break", f.name)
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value = strconv.FormatInt(fv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value = strconv.FormatUint(fv.Uint(), 10)
+		case reflect.Bool:
+			value = strconv.FormatBool(fv.Bool())
+		default:
+			return nil, fmt.Errorf("text: cannot marshal field %s of type %s", f.name, fv.Type())
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", f.name, value)
+	}
+	return []byte(sb.String()), nil
+}
+
+// textUnmarshal decodes "name=value" lines into the struct pointed to by v.
+// Lines naming unknown fields are ignored.
+func textUnmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("text: cannot unmarshal into %T", v)
+	}
+	rv = rv.Elem()
+
+	byName := map[string]field{}
+	for _, f := range fieldsOf(rv.Type()) {
+		byName[f.name] = f
+	}
+
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("text: malformed line %q", line)
+		}
+		f, ok := byName[name]
+		if !ok {
+			continue
+		}
+
+		fv := rv.Field(f.index)
+		if u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := u.UnmarshalText([]byte(value)); err != nil {
+				return fmt.Errorf("text: field %s: %w", name, err)
+			}
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(value)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("text: field %s: %w", name, err)
+			}
+			fv.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("text: field %s: %w", name, err)
+			}
+			fv.SetUint(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("text: field %s: %w", name, err)
+			}
+			fv.SetBool(b)
+		default:
+			return fmt.Errorf("text: cannot unmarshal field %s of type %s", name, fv.Type())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		accept         string
+		expectedFormat Format
+		expectedOK     bool
+	}{
+		{name: "Empty", accept: "", expectedFormat: FormatJSON, expectedOK: true},
+		{name: "Wildcard", accept: "*/*", expectedFormat: FormatJSON, expectedOK: true},
+		{name: "Exact match", accept: "application/xml", expectedFormat: FormatXML, expectedOK: true},
+		{name: "text/xml alias is not matched", accept: "text/xml", expectedOK: false},
+		{name: "Subtype wildcard", accept: "text/*", expectedFormat: FormatText, expectedOK: true},
+		{name: "Quality ordering", accept: "application/json;q=0.1, text/plain", expectedFormat: FormatText, expectedOK: true},
+		{name: "Specific range overrides wildcard", accept: "*/*, application/json;q=0", expectedFormat: FormatXML, expectedOK: true},
+		{name: "Equal quality uses server preference", accept: "application/cbor, application/xml", expectedFormat: FormatXML, expectedOK: true},
+		{name: "Nothing acceptable", accept: "image/png, text/html", expectedOK: false},
+		{name: "Malformed ranges are ignored", accept: ";;;, application/cbor", expectedFormat: FormatCBOR, expectedOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, ok := Negotiate(tt.accept)
+			if ok != tt.expectedOK {
+				t.Fatalf("Negotiate(%q) ok = %v, want %v", tt.accept, ok, tt.expectedOK)
+			}
+			if ok && format != tt.expectedFormat {
+				t.Errorf("Negotiate(%q) = %q, want %q", tt.accept, format, tt.expectedFormat)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		contentType    string
+		expectedFormat Format
+		expectError    bool
+	}{
+		{contentType: "application/json", expectedFormat: FormatJSON},
+		{contentType: "text/plain; charset=utf-8", expectedFormat: FormatText},
+		{contentType: "text/xml", expectedFormat: FormatXML},
+		{contentType: "application/cbor", expectedFormat: FormatCBOR},
+		{contentType: "text/html", expectError: true},
+		{contentType: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			format, err := ParseFormat(tt.contentType)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseFormat(%q) error = %v, expectError %v", tt.contentType, err, tt.expectError)
+			}
+			if format != tt.expectedFormat {
+				t.Errorf("ParseFormat(%q) = %q, want %q", tt.contentType, format, tt.expectedFormat)
+			}
+		})
+	}
+}
+
+func TestFormat_RoundTrip(t *testing.T) {
+	values := []any{
+		&DivisionResult{Remainder: NewNumber(0)},
+		&DivisionResult{Remainder: NewNumber(-7)},
+		&DivisionResult{Remainder: NewNumber(1 << 40)},
+		&DivisionResult{Remainder: mustParseNumber("340282366920938463463374607431768211455")},
+		&DivisionResult{Remainder: mustParseNumber("-340282366920938463463374607431768211456")},
+		&ErrorResult{Message: "Division by zero is not allowed"},
+		&ErrorResult{Message: ""},
+	}
+
+	for _, format := range formats {
+		for _, value := range values {
+			t.Run(string(format), func(t *testing.T) {
+				data, err := format.Marshal(value)
+				if err != nil {
+					t.Fatalf("Marshal(%+v) error: %v", value, err)
+				}
+
+				got := reflect.New(reflect.TypeOf(value).Elem()).Interface()
+				if err := format.Unmarshal(data, got); err != nil {
+					t.Fatalf("Unmarshal(%q) error: %v", data, err)
+				}
+				if !reflect.DeepEqual(got, value) {
+					t.Errorf("Round trip of %+v gave %+v", value, got)
+				}
+			})
+		}
+	}
+}
+
+func TestCBOR(t *testing.T) {
+	// Expected encodings are taken from the examples in RFC 8949 Appendix A.
+	tests := []struct {
+		name    string
+		value   any
+		encoded []byte
+	}{
+		{name: "0", value: 0, encoded: []byte{0x00}},
+		{name: "23", value: 23, encoded: []byte{0x17}},
+		{name: "24", value: 24, encoded: []byte{0x18, 0x18}},
+		{name: "1000", value: 1000, encoded: []byte{0x19, 0x03, 0xe8}},
+		{name: "1000000", value: 1000000, encoded: []byte{0x1a, 0x00, 0x0f, 0x42, 0x40}},
+		{name: "1000000000000", value: int64(1000000000000), encoded: []byte{0x1b, 0x00, 0x00, 0x00, 0xe8, 0xd4, 0xa5, 0x10, 0x00}},
+		{name: "-1", value: -1, encoded: []byte{0x20}},
+		{name: "-1000", value: -1000, encoded: []byte{0x39, 0x03, 0xe7}},
+		{name: "false", value: false, encoded: []byte{0xf4}},
+		{name: "true", value: true, encoded: []byte{0xf5}},
+		{name: "text", value: "IETF", encoded: []byte{0x64, 0x49, 0x45, 0x54, 0x46}},
+		{name: "bytes", value: []byte{1, 2, 3, 4}, encoded: []byte{0x44, 0x01, 0x02, 0x03, 0x04}},
+		{name: "array", value: []int{1, 2, 3}, encoded: []byte{0x83, 0x01, 0x02, 0x03}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := cborMarshal(tt.value)
+			if err != nil {
+				t.Fatalf("cborMarshal(%v) error: %v", tt.value, err)
+			}
+			if !bytes.Equal(encoded, tt.encoded) {
+				t.Errorf("cborMarshal(%v) = % x, want % x", tt.value, encoded, tt.encoded)
+			}
+
+			decoded := reflect.New(reflect.TypeOf(tt.value))
+			if err := cborUnmarshal(tt.encoded, decoded.Interface()); err != nil {
+				t.Fatalf("cborUnmarshal(% x) error: %v", tt.encoded, err)
+			}
+			if !reflect.DeepEqual(decoded.Elem().Interface(), tt.value) {
+				t.Errorf("cborUnmarshal(% x) = %v, want %v", tt.encoded, decoded.Elem().Interface(), tt.value)
+			}
+		})
+	}
+}
+
+func TestCBOR_UnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		value any
+	}{
+		{name: "Empty", data: []byte{}, value: new(int)},
+		{name: "Truncated argument", data: []byte{0x19, 0x03}, value: new(int)},
+		{name: "Truncated text", data: []byte{0x64, 0x49}, value: new(string)},
+		{name: "Type mismatch", data: []byte{0x64, 0x49, 0x45, 0x54, 0x46}, value: new(int)},
+		{name: "Overflow", data: []byte{0x19, 0x03, 0xe8}, value: new(int8)},
+		{name: "Trailing bytes", data: []byte{0x01, 0x02}, value: new(int)},
+		{name: "Indefinite length", data: []byte{0x9f, 0x01, 0xff}, value: new([]int)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := cborUnmarshal(tt.data, tt.value); err == nil {
+				t.Errorf("cborUnmarshal(% x) expected an error", tt.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// oversizedBodySize is the size of the body sent by the oversized body fault,
+// comfortably over the 1 KB clients are expected to accept.
+const oversizedBodySize = 4096
+
+// Faults configures fault injection for chaos testing. Each field other than Seed and Latency is
+// the probability, from 0 to 1, of that fault being injected into a /divide response.
+// Latency is added independently of the other faults, at most one of which is injected per
+// request, so their probabilities should add up to no more than 1.
+type Faults struct {
+	Seed int64 // Seeds the random choice of faults, so that runs are reproducible.
+
+	Latency            time.Duration
+	LatencyProbability float64
+
+	ServerError     float64 // 500 Internal Server Error.
+	TooManyRequests float64 // 429 Too Many Requests with a Retry-After header.
+	SeeOther        float64 // 303 See Other, without a Location so that clients don't follow it.
+	MalformedJSON   float64 // A 200 response with a truncated JSON body.
+	OversizedBody   float64 // A 200 response with a body far larger than a result.
+	Chunked         float64 // A valid result with chunked encoding, so there's no Content-Length.
+	DropConnection  float64 // A 200 response that's cut off part way through the body.
+}
+
+// WithFaults injects faults into /divide responses, as configured.
+func WithFaults(faults Faults) Option {
+	return func(cfg *config) {
+		cfg.faults = &faults
+	}
+}
+
+// fault is a function which writes a faulty response.
+type fault func(w http.ResponseWriter, r *http.Request, next http.Handler)
+
+// faultInjector chooses which faults to inject into each request.
+type faultInjector struct {
+	mu     sync.Mutex
+	rand   *rand.Rand
+	faults Faults
+}
+
+func newFaultInjector(faults Faults) *faultInjector {
+	return &faultInjector{
+		rand:   rand.New(rand.NewPCG(uint64(faults.Seed), uint64(faults.Seed))),
+		faults: faults,
+	}
+}
+
+// choose returns whether to add latency, and the fault to inject or nil for none.
+func (fi *faultInjector) choose() (bool, fault) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	delay := fi.rand.Float64() < fi.faults.LatencyProbability
+
+	roll := fi.rand.Float64()
+	for _, f := range []struct {
+		probability float64
+		fault       fault
+	}{
+		{fi.faults.ServerError, faultServerError},
+		{fi.faults.TooManyRequests, faultTooManyRequests},
+		{fi.faults.SeeOther, faultSeeOther},
+		{fi.faults.MalformedJSON, faultMalformedJSON},
+		{fi.faults.OversizedBody, faultOversizedBody},
+		{fi.faults.Chunked, faultChunked},
+		{fi.faults.DropConnection, faultDropConnection},
+	} {
+		if roll < f.probability {
+			return delay, f.fault
+		}
+		roll -= f.probability
+	}
+	return delay, nil
+}
+
+// injectFaults wraps a handler with fault injection.
+func injectFaults(fi *faultInjector, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/divide" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		delay, fault := fi.choose()
+		if delay {
+			select {
+			case <-time.After(fi.faults.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fault(w, r, next)
+	})
+}
+
+func faultServerError(w http.ResponseWriter, r *http.Request, _ http.Handler) {
+	writeError(w, r, http.StatusInternalServerError, CodeInjectedFault, "Injected server error")
+}
+
+func faultTooManyRequests(w http.ResponseWriter, r *http.Request, _ http.Handler) {
+	w.Header().Set("Retry-After", "1")
+	writeError(w, r, http.StatusTooManyRequests, CodeInjectedFault, "Injected rate limit")
+}
+
+func faultSeeOther(w http.ResponseWriter, r *http.Request, _ http.Handler) {
+	writeError(w, r, http.StatusSeeOther, CodeInjectedFault, "Injected redirect")
+}
+
+func faultMalformedJSON(w http.ResponseWriter, _ *http.Request, _ http.Handler) {
+	w.Header().Set("Content-Type", FormatJSON.ContentType())
+	w.Write([]byte(`{"remainder":`))
+}
+
+func faultOversizedBody(w http.ResponseWriter, _ *http.Request, _ http.Handler) {
+	body := append([]byte(`{"remainder":0,"padding":"`), bytes.Repeat([]byte("x"), oversizedBodySize)...)
+	body = append(body, `"}`...)
+
+	w.Header().Set("Content-Type", FormatJSON.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+// faultChunked serves the real response, but flushes the headers before the body is written so
+// that net/http has to use chunked encoding.
+func faultChunked(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	next.ServeHTTP(&flushingWriter{ResponseWriter: w}, r)
+}
+
+// faultDropConnection promises a full result, sends part of it and then aborts the connection.
+func faultDropConnection(w http.ResponseWriter, _ *http.Request, _ http.Handler) {
+	body := []byte(`{"remainder":0}`)
+	w.Header().Set("Content-Type", FormatJSON.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body[:len(body)/2])
+	http.NewResponseController(w).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+// flushingWriter flushes the headers as soon as they're written.
+type flushingWriter struct {
+	http.ResponseWriter
+}
+
+func (fw *flushingWriter) WriteHeader(statusCode int) {
+	fw.ResponseWriter.WriteHeader(statusCode)
+	http.NewResponseController(fw.ResponseWriter).Flush()
+}
+
+func (fw *flushingWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFaultInjector_Seeded(t *testing.T) {
+	faults := Faults{Seed: 42, LatencyProbability: 0.5, ServerError: 0.25, Chunked: 0.25}
+
+	// The same seed gives the same sequence of faults.
+	first, second := newFaultInjector(faults), newFaultInjector(faults)
+	var delays, injected int
+	for range 1000 {
+		delay1, fault1 := first.choose()
+		delay2, fault2 := second.choose()
+		if delay1 != delay2 || (fault1 == nil) != (fault2 == nil) {
+			t.Fatalf("Injectors with the same seed diverged")
+		}
+		if delay1 {
+			delays++
+		}
+		if fault1 != nil {
+			injected++
+		}
+	}
+
+	// Roughly the configured proportion of requests are affected.
+	if delays < 400 || delays > 600 {
+		t.Errorf("Expected about 500 delays, got %d", delays)
+	}
+	if injected < 400 || injected > 600 {
+		t.Errorf("Expected about 500 faults, got %d", injected)
+	}
+
+	if delay, fault := newFaultInjector(Faults{}).choose(); delay || fault != nil {
+		t.Errorf("Expected no faults when none are configured")
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	tests := []struct {
+		name                  string
+		faults                Faults
+		expectedStatus        int
+		expectedContentLength int64
+		expectReadError       bool
+		expectedBody          string
+	}{
+		{
+			name:                  "No faults",
+			faults:                Faults{},
+			expectedStatus:        http.StatusOK,
+			expectedContentLength: int64(len(`{"remainder":1}`)),
+			expectedBody:          `{"remainder":1}`,
+		},
+		{
+			name:                  "Server error",
+			faults:                Faults{ServerError: 1},
+			expectedStatus:        http.StatusInternalServerError,
+			expectedContentLength: int64(len(`{"message":"Injected server error"}`)),
+			expectedBody:          `{"message":"Injected server error"}`,
+		},
+		{
+			name:                  "Too many requests",
+			faults:                Faults{TooManyRequests: 1},
+			expectedStatus:        http.StatusTooManyRequests,
+			expectedContentLength: int64(len(`{"message":"Injected rate limit"}`)),
+			expectedBody:          `{"message":"Injected rate limit"}`,
+		},
+		{
+			name:                  "See other",
+			faults:                Faults{SeeOther: 1},
+			expectedStatus:        http.StatusSeeOther,
+			expectedContentLength: int64(len(`{"message":"Injected redirect"}`)),
+			expectedBody:          `{"message":"Injected redirect"}`,
+		},
+		{
+			name:                  "Malformed JSON",
+			faults:                Faults{MalformedJSON: 1},
+			expectedStatus:        http.StatusOK,
+			expectedContentLength: int64(len(`{"remainder":`)),
+			expectedBody:          `{"remainder":`,
+		},
+		{
+			name:                  "Oversized body",
+			faults:                Faults{OversizedBody: 1},
+			expectedStatus:        http.StatusOK,
+			expectedContentLength: int64(len(`{"remainder":0,"padding":""}`) + oversizedBodySize),
+		},
+		{
+			name:                  "Chunked",
+			faults:                Faults{Chunked: 1},
+			expectedStatus:        http.StatusOK,
+			expectedContentLength: -1,
+			expectedBody:          `{"remainder":1}`,
+		},
+		{
+			name:                  "Dropped connection",
+			faults:                Faults{DropConnection: 1},
+			expectedStatus:        http.StatusOK,
+			expectedContentLength: int64(len(`{"remainder":0}`)),
+			expectReadError:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := New(WithFaults(tt.faults))
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/divide?a=10&b=3")
+			if err != nil {
+				t.Fatalf("Failed to make GET request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if resp.ContentLength != tt.expectedContentLength {
+				t.Errorf("Expected Content-Length %d, got %d", tt.expectedContentLength, resp.ContentLength)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if tt.expectReadError {
+				if err == nil {
+					t.Errorf("Expected an error reading the body, got %q", body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to read response body: %v", err)
+			}
+			if tt.expectedBody != "" && string(body) != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestServer_FaultsWithCompression(t *testing.T) {
+	tests := []struct {
+		name                  string
+		faults                Faults
+		expectedContentLength int64
+		expectReadError       bool
+	}{
+		{
+			name:                  "Chunked",
+			faults:                Faults{Chunked: 1},
+			expectedContentLength: -1,
+		},
+		{
+			name:                  "Dropped connection",
+			faults:                Faults{DropConnection: 1},
+			expectedContentLength: int64(len(`{"remainder":0}`)),
+			expectReadError:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The faults flush through the compression, so they're injected as they are without it.
+			server, err := New(WithFaults(tt.faults), WithCompression(DefaultCompressionMinSize))
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			defer server.Close()
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/divide?a=10&b=3", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to make GET request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.ContentLength != tt.expectedContentLength {
+				t.Errorf("Expected Content-Length %d, got %d", tt.expectedContentLength, resp.ContentLength)
+			}
+			if tt.expectedContentLength < 0 && !slices.Equal(resp.TransferEncoding, []string{"chunked"}) {
+				t.Errorf("Expected chunked encoding, got %v", resp.TransferEncoding)
+			}
+			if _, err := io.ReadAll(resp.Body); (err != nil) != tt.expectReadError {
+				t.Errorf("Expected a read error %v, got %v", tt.expectReadError, err)
+			}
+		})
+	}
+}
+
+func TestServer_FaultLatency(t *testing.T) {
+	const latency = 100 * time.Millisecond
+	server, err := New(WithFaults(Faults{Latency: latency, LatencyProbability: 1}))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/divide?a=10&b=3")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+
+	if elapsed := time.Since(start); elapsed < latency {
+		t.Errorf("Expected the response to take at least %v, took %v", latency, elapsed)
+	}
+
+	// Probes are never delayed.
+	start = time.Now()
+	resp, err = http.Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed >= latency {
+		t.Errorf("Expected /healthz not to be delayed, took %v", elapsed)
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import "net/http"
+
+// WithH2C makes the server accept unencrypted HTTP/2 (h2c) alongside HTTP/1.1, so that clients
+// can multiplex many requests over one connection. Its client uses h2c with prior knowledge.
+// With TLS, HTTP/2 is negotiated through ALPN instead.
+func WithH2C() Option {
+	return func(cfg *config) {
+		cfg.h2c = true
+	}
+}
+
+// h2cProtocols returns the protocols a server accepts with h2c enabled.
+func h2cProtocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return protocols
+}
+
+// H2CClientProtocols returns the protocols for an http.Transport to speak HTTP/2 to a server with
+// h2c enabled: h2c with prior knowledge for http URLs, and HTTP/2 over TLS for https URLs.
+func H2CClientProtocols() *http.Protocols {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return protocols
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestServer_H2C(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "h2c", opts: []Option{WithH2C()}},
+		{name: "HTTP/2 over TLS", opts: []Option{WithH2C(), WithSelfSignedTLS()}},
+		{name: "h2c over a Unix socket", opts: []Option{WithH2C(), WithUnixSocket(socketPath(t), 0)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := New(tt.opts...)
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+			defer server.Close()
+
+			resp, err := server.Client().Get(server.URL + "/divide?a=10&b=3")
+			if err != nil {
+				t.Fatalf("Failed to make GET request: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.ProtoMajor != 2 {
+				t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+			}
+			if string(body) != `{"remainder":1}` {
+				t.Errorf("Expected body %s, got %s", `{"remainder":1}`, body)
+			}
+		})
+	}
+}
+
+func TestServer_H2C_HTTP1StillServed(t *testing.T) {
+	server, err := New(WithH2C())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/divide?a=10&b=3")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a 200 over HTTP/1.1, got %d over %s", resp.StatusCode, resp.Proto)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// HealthResult is returned by the /healthz and /readyz endpoints.
+type HealthResult struct {
+	Status string `json:"status" xml:"status"`
+}
+
+// VersionResult is returned by the /version endpoint.
+type VersionResult struct {
+	Module    string `json:"module" xml:"module"`
+	Version   string `json:"version" xml:"version"`
+	Revision  string `json:"revision,omitempty" xml:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty" xml:"modified,omitempty"`
+	GoVersion string `json:"goVersion" xml:"goVersion"`
+}
+
+// WithDrainDelay keeps the server serving for the delay after Close is called, while its
+// readiness check fails, so that load balancers stop sending it traffic before it goes away.
+func WithDrainDelay(delay time.Duration) Option {
+	return func(cfg *config) {
+		cfg.drainDelay = delay
+	}
+}
+
+// handleHealth reports that the server is alive. It succeeds as long as requests are being served.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeResult(w, requestFormat(r), http.StatusOK, HealthResult{Status: "ok"})
+}
+
+// handleReady reports whether the server is ready for traffic, failing once it's shutting down.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		writeResult(w, requestFormat(r), http.StatusServiceUnavailable, HealthResult{Status: "shutting down"})
+		return
+	}
+	writeResult(w, requestFormat(r), http.StatusOK, HealthResult{Status: "ready"})
+}
+
+// handleVersion reports the build information embedded in the binary.
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Build information unavailable")
+		return
+	}
+
+	result := VersionResult{
+		Module:    info.Main.Path,
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			result.Revision = setting.Value
+		case "vcs.modified":
+			result.Modified = setting.Value == "true"
+		}
+	}
+	writeResult(w, requestFormat(r), http.StatusOK, result)
+}
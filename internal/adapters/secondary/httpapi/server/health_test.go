@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// getJSON makes a GET request and decodes the JSON response into v, returning the status code.
+func getJSON(t *testing.T, url string, v any) int {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestServer_Probes(t *testing.T) {
+	// Probes don't need credentials, and aren't rate limited.
+	server, err := New(
+		WithCredentials(Credential{Key: "key"}),
+		WithRateLimit(0.001, 1),
+		WithDrainDelay(200*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	for range 2 {
+		var health HealthResult
+		if status := getJSON(t, server.URL+"/healthz", &health); status != http.StatusOK || health.Status != "ok" {
+			t.Errorf("Expected /healthz to report ok, got %d %+v", status, health)
+		}
+
+		var ready HealthResult
+		if status := getJSON(t, server.URL+"/readyz", &ready); status != http.StatusOK || ready.Status != "ready" {
+			t.Errorf("Expected /readyz to report ready, got %d %+v", status, ready)
+		}
+	}
+
+	var er ErrorResult
+	if status := getJSON(t, server.URL+"/divide?a=10&b=3", &er); status != http.StatusUnauthorized {
+		t.Errorf("Expected /divide to still need credentials, got %d", status)
+	}
+
+	// While draining, the server is alive but not ready.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		server.Close()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var health HealthResult
+	if status := getJSON(t, server.URL+"/healthz", &health); status != http.StatusOK {
+		t.Errorf("Expected /healthz to succeed while draining, got %d", status)
+	}
+	var ready HealthResult
+	if status := getJSON(t, server.URL+"/readyz", &ready); status != http.StatusServiceUnavailable || ready.Status != "shutting down" {
+		t.Errorf("Expected /readyz to fail while draining, got %d %+v", status, ready)
+	}
+
+	<-closed
+}
+
+func TestServer_Version(t *testing.T) {
+	server, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	var version VersionResult
+	if status := getJSON(t, server.URL+"/version", &version); status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, status)
+	}
+	if version.GoVersion != runtime.Version() {
+		t.Errorf("Expected Go version %q, got %q", runtime.Version(), version.GoVersion)
+	}
+}
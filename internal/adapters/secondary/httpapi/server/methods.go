@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routeMethods lists the methods supported on each path. Paths not listed are left to the
+// handlers, which reject them as unsupported.
+var routeMethods = map[string][]string{
+	"/divide":  {http.MethodGet, http.MethodHead, http.MethodOptions},
+	"/rpc":     {http.MethodPost, http.MethodOptions},
+	"/healthz": {http.MethodGet, http.MethodHead, http.MethodOptions},
+	"/readyz":  {http.MethodGet, http.MethodHead, http.MethodOptions},
+	"/version": {http.MethodGet, http.MethodHead, http.MethodOptions},
+}
+
+// allowMethods rejects requests using methods the path doesn't support with 405 Method Not
+// Allowed, and answers OPTIONS requests itself. HEAD requests are handled like GET, with
+// net/http discarding the body.
+func allowMethods(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods, ok := routeMethods[r.URL.Path]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case !slices.Contains(methods, r.Method):
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method Not Allowed")
+
+		case r.Method == http.MethodOptions:
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestServer_Methods(t *testing.T) {
+	server, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		name                  string
+		method                string
+		path                  string
+		expectedStatus        int
+		expectedAllow         string
+		expectedContentLength int64
+		expectEmptyBody       bool
+	}{
+		{
+			name:                  "GET",
+			method:                http.MethodGet,
+			path:                  "/divide?a=10&b=3",
+			expectedStatus:        http.StatusOK,
+			expectedContentLength: int64(len(`{"remainder":1}`)),
+		},
+		{
+			name:                  "HEAD has the headers of GET but no body",
+			method:                http.MethodHead,
+			path:                  "/divide?a=10&b=3",
+			expectedStatus:        http.StatusOK,
+			expectedContentLength: int64(len(`{"remainder":1}`)),
+			expectEmptyBody:       true,
+		},
+		{
+			name:                  "OPTIONS lists the allowed methods",
+			method:                http.MethodOptions,
+			path:                  "/divide",
+			expectedStatus:        http.StatusNoContent,
+			expectedAllow:         "GET, HEAD, OPTIONS",
+			expectedContentLength: 0,
+			expectEmptyBody:       true,
+		},
+		{
+			name:                  "POST is not allowed",
+			method:                http.MethodPost,
+			path:                  "/divide?a=10&b=3",
+			expectedStatus:        http.StatusMethodNotAllowed,
+			expectedAllow:         "GET, HEAD, OPTIONS",
+			expectedContentLength: int64(len(`{"message":"Method Not Allowed"}`)),
+		},
+		{
+			name:                  "DELETE is not allowed on probes",
+			method:                http.MethodDelete,
+			path:                  "/healthz",
+			expectedStatus:        http.StatusMethodNotAllowed,
+			expectedAllow:         "GET, HEAD, OPTIONS",
+			expectedContentLength: int64(len(`{"message":"Method Not Allowed"}`)),
+		},
+		{
+			name:                  "Unknown paths are still not found",
+			method:                http.MethodPost,
+			path:                  "/unsupported",
+			expectedStatus:        http.StatusNotFound,
+			expectedContentLength: int64(len(`{"message":"Unsupported path"}`)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read response body: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Allow"); got != tt.expectedAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, got)
+			}
+			if resp.ContentLength != tt.expectedContentLength {
+				t.Errorf("Expected Content-Length %d, got %d", tt.expectedContentLength, resp.ContentLength)
+			}
+			if tt.expectEmptyBody != (len(body) == 0) {
+				t.Errorf("Expected empty body %v, got %q", tt.expectEmptyBody, body)
+			}
+		})
+	}
+}
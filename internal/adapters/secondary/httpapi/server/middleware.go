@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	// RequestIDHeader carries the ID used to match up client and server logs for a request.
+	RequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength is the longest request ID accepted from a client.
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request being handled, or "" if there isn't one.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b) // Never returns an error.
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether a client supplied request ID is safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder wraps a ResponseWriter to record the status code and number of bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if sr.status == 0 {
+		sr.status = statusCode
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// withRequestID passes on the request's X-Request-ID, or generates one, adding it to the
+// request context and the response headers.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// logRequests logs one line per request once it has been handled.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			slog.Info("Request handled",
+				slog.String("request_id", RequestID(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", sr.status),
+				slog.Int("bytes", sr.bytes),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		}()
+
+		next.ServeHTTP(sr, r)
+	})
+}
+
+// recoverPanics turns a panic in a handler into a 500 response, if nothing has been written yet.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				// Deliberate aborts are left for net/http to handle quietly.
+				panic(rec)
+			}
+
+			slog.Error("Panic handling request",
+				slog.String("request_id", RequestID(r.Context())),
+				slog.Any("panic", rec),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if sr.status == 0 {
+				writeError(sr, r, http.StatusInternalServerError, CodeInternal, "Internal Server Error")
+			}
+		}()
+
+		next.ServeHTTP(sr, r)
+	})
+}
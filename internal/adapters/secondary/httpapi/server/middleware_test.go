@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	tests := []struct {
+		name       string
+		incoming   string
+		expectSame bool
+	}{
+		{name: "Passed on", incoming: "run-1234", expectSame: true},
+		{name: "Generated when missing", incoming: ""},
+		{name: "Replaced when it contains spaces", incoming: "not valid"},
+		{name: "Replaced when too long", incoming: strings.Repeat("x", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/divide", nil)
+			if tt.incoming != "" {
+				r.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if seen == "" {
+				t.Fatalf("No request ID in the request context")
+			}
+			if got := rec.Header().Get(RequestIDHeader); got != seen {
+				t.Errorf("Response header %q doesn't match context %q", got, seen)
+			}
+			if tt.expectSame != (seen == tt.incoming) {
+				t.Errorf("Request ID %q, incoming %q, expected the same: %v", seen, tt.incoming, tt.expectSame)
+			}
+		})
+	}
+}
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	server, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/divide?a=10&b=0", nil)
+	req.Header.Set(RequestIDHeader, "log-test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(RequestIDHeader); got != "log-test" {
+		t.Errorf("Expected the request ID to be echoed, got %q", got)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to decode log entry %q: %v", buf.String(), err)
+	}
+	expected := map[string]any{
+		"msg":        "Request handled",
+		"request_id": "log-test",
+		"method":     "GET",
+		"path":       "/divide",
+		"status":     float64(http.StatusBadRequest),
+		"bytes":      float64(len(`{"message":"Division by zero is not allowed"}`)),
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected log attribute %s = %v, got %v", key, value, entry[key])
+		}
+	}
+	for _, key := range []string{"latency", "remote_addr"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("Expected log attribute %s", key)
+		}
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+
+	t.Run("Panic before writing", func(t *testing.T) {
+		handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/divide", nil))
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+		}
+		if expected := `{"message":"Internal Server Error"}`; rec.Body.String() != expected {
+			t.Errorf("Expected body %s, got %s", expected, rec.Body.String())
+		}
+	})
+
+	t.Run("Panic after writing", func(t *testing.T) {
+		handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic("boom")
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/divide", nil))
+
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("Expected the original status %d, got %d", http.StatusAccepted, rec.Code)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("Expected nothing more to be written, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("Aborted handler", func(t *testing.T) {
+		handler := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Errorf("Expected http.ErrAbortHandler to be re-panicked, got %v", rec)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/divide", nil))
+	})
+}
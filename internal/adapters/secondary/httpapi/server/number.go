@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// maxNumberDigits is the most decimal digits accepted in a Number. Big integer arithmetic gets
+// slow well before the size limits on URLs and bodies, so this keeps the cost of a request down.
+const maxNumberDigits = 4096
+
+// maxSafeInteger is the largest integer a JSON number can carry without losing precision in
+// clients which decode numbers as float64, such as JavaScript's.
+var maxSafeInteger = big.NewInt(1<<53 - 1)
+
+// Number is an arbitrary-precision integer.
+// It's encoded as a JSON number when clients can decode it exactly, and as a decimal string
+// otherwise. Numbers are comparable, and the zero value is 0.
+type Number struct {
+	decimal string // Canonical decimal form, empty for zero.
+}
+
+// NewNumber returns the Number for n.
+func NewNumber(n int64) Number {
+	return NewBigNumber(big.NewInt(n))
+}
+
+// NewBigNumber returns the Number for n, which is copied.
+func NewBigNumber(n *big.Int) Number {
+	if n.Sign() == 0 {
+		return Number{}
+	}
+	return Number{decimal: n.String()}
+}
+
+// ParseNumber parses a decimal integer, with an optional sign.
+func ParseNumber(s string) (Number, error) {
+	if len(strings.TrimLeft(s, "+-")) > maxNumberDigits {
+		return Number{}, fmt.Errorf("number has more than %d digits", maxNumberDigits)
+	}
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return Number{}, fmt.Errorf("invalid number %q", s)
+	}
+	return NewBigNumber(n), nil
+}
+
+// Big returns the Number as a new big.Int.
+func (n Number) Big() *big.Int {
+	b, _ := new(big.Int).SetString(n.String(), 10)
+	return b
+}
+
+// Int64 returns the Number as an int64, and whether it fits.
+func (n Number) Int64() (int64, bool) {
+	b := n.Big()
+	return b.Int64(), b.IsInt64()
+}
+
+// IsZero reports whether the Number is 0.
+func (n Number) IsZero() bool {
+	return n.decimal == ""
+}
+
+// String returns the Number in decimal.
+func (n Number) String() string {
+	if n.decimal == "" {
+		return "0"
+	}
+	return n.decimal
+}
+
+// MarshalText implements encoding.TextMarshaler, which the XML and text formats use.
+func (n Number) MarshalText() ([]byte, error) {
+	return []byte(n.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (n *Number) UnmarshalText(text []byte) error {
+	parsed, err := ParseNumber(string(text))
+	if err != nil {
+		return err
+	}
+	*n = parsed
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Numbers outside ±(2^53-1) are encoded as strings.
+func (n Number) MarshalJSON() ([]byte, error) {
+	if n.Big().CmpAbs(maxSafeInteger) > 0 {
+		return json.Marshal(n.String())
+	}
+	return []byte(n.String()), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting integers as either numbers or strings.
+func (n *Number) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return n.UnmarshalText([]byte(s))
+	}
+	return n.UnmarshalText(data)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+// mustParseNumber parses a Number for test values, panicking if it's invalid.
+func mustParseNumber(s string) Number {
+	n, err := ParseNumber(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{input: "0", expected: "0"},
+		{input: "-0", expected: "0"},
+		{input: "+42", expected: "42"},
+		{input: "007", expected: "7"},
+		{input: "-340282366920938463463374607431768211456", expected: "-340282366920938463463374607431768211456"},
+		{input: "", expectError: true},
+		{input: "1.5", expectError: true},
+		{input: "1e3", expectError: true},
+		{input: "0x10", expectError: true},
+		{input: "1_000", expectError: true},
+		{input: " 1", expectError: true},
+		{input: "--1", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			n, err := ParseNumber(tt.input)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseNumber(%q) error = %v, expectError %v", tt.input, err, tt.expectError)
+			}
+			if !tt.expectError && n.String() != tt.expected {
+				t.Errorf("ParseNumber(%q) = %s, want %s", tt.input, n, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNumber_Comparable(t *testing.T) {
+	if NewNumber(0) != (Number{}) {
+		t.Errorf("NewNumber(0) isn't equal to the zero Number")
+	}
+	if NewNumber(-7) != mustParseNumber("-007") {
+		t.Errorf("NewNumber(-7) isn't equal to the parsed Number")
+	}
+	if n, ok := mustParseNumber("9223372036854775808").Int64(); ok {
+		t.Errorf("Int64() of 2^63 = %d, expected it not to fit", n)
+	}
+}
+
+func TestNumber_JSON(t *testing.T) {
+	tests := []struct {
+		number  string
+		encoded string
+	}{
+		{number: "0", encoded: `0`},
+		{number: "-7", encoded: `-7`},
+		{number: "9007199254740991", encoded: `9007199254740991`},
+		{number: "-9007199254740991", encoded: `-9007199254740991`},
+		{number: "9007199254740992", encoded: `"9007199254740992"`},
+		{number: "-9007199254740992", encoded: `"-9007199254740992"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			encoded, err := json.Marshal(mustParseNumber(tt.number))
+			if err != nil {
+				t.Fatalf("Marshal() error: %v", err)
+			}
+			if string(encoded) != tt.encoded {
+				t.Errorf("Marshal() = %s, want %s", encoded, tt.encoded)
+			}
+		})
+	}
+
+	// Either form is accepted when decoding.
+	for _, input := range []string{`12345678901234567890`, `"12345678901234567890"`} {
+		var n Number
+		if err := json.Unmarshal([]byte(input), &n); err != nil || n.String() != "12345678901234567890" {
+			t.Errorf("Unmarshal(%s) = %s, %v", input, n, err)
+		}
+	}
+	for _, input := range []string{`1.5`, `1e3`, `"abc"`, `true`} {
+		var n Number
+		if err := json.Unmarshal([]byte(input), &n); err == nil {
+			t.Errorf("Unmarshal(%s) expected an error", input)
+		}
+	}
+}
+
+func TestNumber_CBOR(t *testing.T) {
+	// Expected encodings are taken from the examples in RFC 8949 Appendix A.
+	tests := []struct {
+		number  string
+		encoded []byte
+	}{
+		{number: "0", encoded: []byte{0x00}},
+		{number: "-1000", encoded: []byte{0x39, 0x03, 0xe7}},
+		{number: "18446744073709551615", encoded: []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{number: "18446744073709551616", encoded: []byte{0xc2, 0x49, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{number: "-18446744073709551616", encoded: []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{number: "-18446744073709551617", encoded: []byte{0xc3, 0x49, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			encoded, err := cborMarshal(mustParseNumber(tt.number))
+			if err != nil {
+				t.Fatalf("cborMarshal() error: %v", err)
+			}
+			if !bytes.Equal(encoded, tt.encoded) {
+				t.Errorf("cborMarshal() = % x, want % x", encoded, tt.encoded)
+			}
+
+			var decoded Number
+			if err := cborUnmarshal(tt.encoded, &decoded); err != nil {
+				t.Fatalf("cborUnmarshal(% x) error: %v", tt.encoded, err)
+			}
+			if decoded.String() != tt.number {
+				t.Errorf("cborUnmarshal(% x) = %s, want %s", tt.encoded, decoded, tt.number)
+			}
+		})
+	}
+
+	// Other tags and oversized bignums are rejected.
+	tooLarge := cborAppendHead([]byte{0xc2}, cborBytes, maxNumberDigits)
+	tooLarge = append(tooLarge, make([]byte, maxNumberDigits)...)
+	for _, data := range [][]byte{{0xc1, 0x00}, {0xc2, 0x01}, tooLarge} {
+		var n Number
+		if err := cborUnmarshal(data, &n); err == nil {
+			t.Errorf("cborUnmarshal(% x) expected an error", data[:min(len(data), 4)])
+		}
+	}
+}
+
+func TestDivide_Big(t *testing.T) {
+	a, _ := new(big.Int).SetString("-340282366920938463463374607431768211455", 10)
+	b := big.NewInt(1000)
+
+	result, err := divide(a, b)
+	if err != nil {
+		t.Fatalf("divide() error: %v", err)
+	}
+	if result.Remainder.String() != "-455" {
+		t.Errorf("divide() remainder = %s, want -455", result.Remainder)
+	}
+	if _, err := divide(a, new(big.Int)); err != errDivisionByZero {
+		t.Errorf("divide() by zero error = %v, want %v", err, errDivisionByZero)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ProblemContentType is the media type of RFC 9457 Problem Details error responses.
+	ProblemContentType = "application/problem+json"
+
+	// ProblemTypePrefix is followed by a problem's code to make its type URI.
+	ProblemTypePrefix = "urn:fizzbuzz:problem:"
+)
+
+// Problem codes, a stable way for clients to tell errors apart without parsing their detail.
+const (
+	CodeInvalidParam        = "invalid_param"
+	CodeDivisionByZero      = "division_by_zero"
+	CodeNotFound            = "not_found"
+	CodeNotAcceptable       = "not_acceptable"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeOriginNotAllowed    = "origin_not_allowed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeRateLimited         = "rate_limited"
+	CodeOverloaded          = "overloaded"
+	CodeBodyTooLarge        = "body_too_large"
+	CodeInvalidBody         = "invalid_body"
+	CodeUnsupportedEncoding = "unsupported_encoding"
+	CodeInternal            = "internal_error"
+	CodeInjectedFault       = "injected_fault"
+)
+
+// problemTitles are the short, unchanging summaries of each problem code.
+var problemTitles = map[string]string{
+	CodeInvalidParam:        "Invalid parameter",
+	CodeDivisionByZero:      "Division by zero",
+	CodeNotFound:            "Not found",
+	CodeNotAcceptable:       "Not acceptable",
+	CodeMethodNotAllowed:    "Method not allowed",
+	CodeOriginNotAllowed:    "Origin not allowed",
+	CodeUnauthorized:        "Unauthorized",
+	CodeForbidden:           "Forbidden",
+	CodeRateLimited:         "Rate limited",
+	CodeOverloaded:          "Overloaded",
+	CodeBodyTooLarge:        "Body too large",
+	CodeInvalidBody:         "Invalid body",
+	CodeUnsupportedEncoding: "Unsupported encoding",
+	CodeInternal:            "Internal error",
+	CodeInjectedFault:       "Injected fault",
+}
+
+// Problem is an RFC 9457 Problem Details error response, extended with a machine-readable code.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"` // The path of the request which failed.
+	Code     string `json:"code"`
+}
+
+// NewProblem returns the Problem for a code, with the given status and detail.
+func NewProblem(statusCode int, code, detail, instance string) Problem {
+	title, ok := problemTitles[code]
+	if !ok {
+		title = http.StatusText(statusCode)
+	}
+	return Problem{
+		Type:     ProblemTypePrefix + code,
+		Title:    title,
+		Status:   statusCode,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code,
+	}
+}
+
+// IsProblemContentType reports whether a Content-Type header value is ProblemContentType.
+func IsProblemContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.EqualFold(strings.TrimSpace(mediaType), ProblemContentType)
+}
+
+// writeError writes an error response for the request.
+// Clients which explicitly accept application/problem+json, at least as much as the format
+// negotiated for results, get a Problem. Others, including those that send no Accept header or
+// only wildcards, get an ErrorResult holding the detail in the negotiated format, as they did
+// before Problems were introduced.
+func writeError(w http.ResponseWriter, r *http.Request, statusCode int, code, detail string) {
+	format := requestFormat(r)
+
+	ranges := parseAccept(r.Header.Get("Accept"))
+	if quality := ranges.quality(ProblemContentType); !ranges.names(ProblemContentType) || quality == 0 || quality < ranges.quality(string(format)) {
+		writeResult(w, format, statusCode, ErrorResult{Message: detail})
+		return
+	}
+
+	body, err := json.Marshal(NewProblem(statusCode, code, detail, r.URL.Path))
+	if err != nil {
+		writeResult(w, format, statusCode, ErrorResult{Message: detail})
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
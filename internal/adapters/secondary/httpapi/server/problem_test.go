@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// problemJSON returns the Problem Details body expected for an error.
+func problemJSON(statusCode int, code, detail, instance string) string {
+	return fmt.Sprintf(`{"type":"urn:fizzbuzz:problem:%s","title":"%s","status":%d,"detail":"%s","instance":"%s","code":"%s"}`,
+		code, problemTitles[code], statusCode, detail, instance, code)
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name                string
+		accept              string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "No Accept header gets the legacy error",
+			expectedContentType: "application/json",
+			expectedBody:        `{"message":"Division by zero is not allowed"}`,
+		},
+		{
+			name:                "Wildcard gets the legacy error",
+			accept:              "*/*",
+			expectedContentType: "application/json",
+			expectedBody:        `{"message":"Division by zero is not allowed"}`,
+		},
+		{
+			name:                "Problems matched by a wildcard get the legacy error",
+			accept:              "application/*",
+			expectedContentType: "application/json",
+			expectedBody:        `{"message":"Division by zero is not allowed"}`,
+		},
+		{
+			name:                "Problems alongside results",
+			accept:              "application/xml, application/problem+json",
+			expectedContentType: ProblemContentType,
+			expectedBody:        problemJSON(http.StatusBadRequest, CodeDivisionByZero, "Division by zero is not allowed", "/divide"),
+		},
+		{
+			name:                "Only problems",
+			accept:              "application/problem+json",
+			expectedContentType: ProblemContentType,
+			expectedBody:        problemJSON(http.StatusBadRequest, CodeDivisionByZero, "Division by zero is not allowed", "/divide"),
+		},
+		{
+			name:                "Old JSON clients get the legacy error",
+			accept:              "application/json",
+			expectedContentType: "application/json",
+			expectedBody:        `{"message":"Division by zero is not allowed"}`,
+		},
+		{
+			name:                "Problems less preferred than JSON",
+			accept:              "application/json, application/problem+json;q=0.5",
+			expectedContentType: "application/json",
+			expectedBody:        `{"message":"Division by zero is not allowed"}`,
+		},
+		{
+			name:                "Old XML clients get the legacy error",
+			accept:              "application/xml",
+			expectedContentType: "application/xml",
+			expectedBody:        `<ErrorResult><message>Division by zero is not allowed</message></ErrorResult>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/divide?a=10&b=0", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			writeError(rec, r, http.StatusBadRequest, CodeDivisionByZero, "Division by zero is not allowed")
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, got)
+			}
+			if rec.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	problem := NewProblem(http.StatusTeapot, "teapot", "", "/brew")
+	if problem.Title != "I'm a teapot" || problem.Type != "urn:fizzbuzz:problem:teapot" {
+		t.Errorf("Unknown codes should be titled by their status, got %+v", problem)
+	}
+}
+
+func TestIsProblemContentType(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"application/problem+json":                true,
+		"Application/Problem+JSON; charset=utf-8": true,
+		"application/json":                        false,
+		"":                                        false,
+	} {
+		if got := IsProblemContentType(contentType); got != expected {
+			t.Errorf("IsProblemContentType(%q) = %v, want %v", contentType, got, expected)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// APIKeyHeader identifies the calling client. Clients without an authenticated one are
+	// identified by IP address.
+	APIKeyHeader = "X-API-Key"
+
+	// maxBuckets is the number of clients tracked before idle buckets are evicted.
+	maxBuckets = 10000
+)
+
+// WithRateLimit limits each client, identified by API key if WithCredentials is also given or by
+// IP address otherwise, to perSecond requests per second on average, with bursts of up to burst
+// requests. With WithCredentials, requests which fail authentication are limited by IP address too,
+// so keys and signatures can't be guessed at any speed. Requests over the limit are rejected with 429 Too Many Requests and a Retry-After header.
+// A perSecond of zero or less disables the limit, and a burst below 1 is treated as 1.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(cfg *config) {
+		cfg.rateLimit = perSecond
+		cfg.rateBurst = burst
+	}
+}
+
+// WithMaxConcurrent limits the number of requests the server handles at once, across all clients.
+// Requests beyond the limit are shed with 503 Service Unavailable and a Retry-After header.
+// A limit of zero or less disables load shedding.
+func WithMaxConcurrent(limit int) Option {
+	return func(cfg *config) {
+		cfg.maxConcurrent = limit
+	}
+}
+
+// tokenBucket holds the tokens available to one client as of the last time it was used.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket rate limiter with a bucket per client.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // Tokens added per second.
+	burst   float64 // Capacity of each bucket.
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    perSecond,
+		burst:   float64(max(burst, 1)),
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the client's bucket. If the bucket is empty it returns false and
+// how long the client should wait before a token is available.
+func (rl *rateLimiter) allow(client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	bucket := rl.refill(client)
+	if bucket.tokens < 1 {
+		return false, rl.wait(bucket)
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// peek is like allow, but leaves the token in the bucket.
+func (rl *rateLimiter) peek(client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if bucket := rl.refill(client); bucket.tokens < 1 {
+		return false, rl.wait(bucket)
+	}
+	return true, 0
+}
+
+// refill returns the client's bucket, with the tokens added since it was last used.
+func (rl *rateLimiter) refill(client string) *tokenBucket {
+	now := rl.now()
+	bucket, ok := rl.buckets[client]
+	if !ok {
+		if len(rl.buckets) >= maxBuckets {
+			rl.evict(now)
+		}
+		bucket = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[client] = bucket
+	}
+
+	bucket.tokens = min(rl.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rl.rate)
+	bucket.last = now
+	return bucket
+}
+
+// wait returns how long until the bucket has a whole token.
+func (rl *rateLimiter) wait(bucket *tokenBucket) time.Duration {
+	return time.Duration((1 - bucket.tokens) / rl.rate * float64(time.Second))
+}
+
+// evict removes the buckets which would have refilled completely by now, as forgetting
+// them makes no difference to their clients.
+func (rl *rateLimiter) evict(now time.Time) {
+	for client, bucket := range rl.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, client)
+		}
+	}
+}
+
+// clientID identifies the client making a request, by API key if it was authenticated with one or
+// by IP address. Unauthenticated keys are ignored, as a client could get round its limit by
+// sending a different one with each request.
+func clientID(r *http.Request) string {
+	if key := authenticatedKey(r.Context()); key != "" {
+		return "key:" + key
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// retryAfterSeconds converts a wait into a Retry-After header value, rounding up to whole seconds.
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
+
+// rateLimit rejects requests from clients which have exceeded their rate limit.
+func rateLimit(rl *rateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := rl.allow(clientID(r)); !ok {
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			writeError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shedLoad rejects requests while limit requests are already being handled.
+func shedLoad(limit int, next http.Handler) http.Handler {
+	inFlight := make(chan struct{}, limit)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case inFlight <- struct{}{}:
+			defer func() { <-inFlight }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, http.StatusServiceUnavailable, CodeOverloaded, "Server overloaded")
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := newRateLimiter(2, 3) // 2 requests per second, bursts of 3.
+	rl.now = func() time.Time { return now }
+
+	// The burst is available straight away.
+	for i := range 3 {
+		if ok, _ := rl.allow("client"); !ok {
+			t.Fatalf("Request %d of the burst was refused", i+1)
+		}
+	}
+
+	ok, wait := rl.allow("client")
+	if ok {
+		t.Fatalf("Request beyond the burst was allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Expected a wait of 500ms, got %v", wait)
+	}
+
+	// Other clients have their own bucket.
+	if ok, _ := rl.allow("other"); !ok {
+		t.Errorf("Request from another client was refused")
+	}
+
+	// Tokens are replenished at the configured rate.
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := rl.allow("client"); !ok {
+		t.Errorf("Request after waiting was refused")
+	}
+	if ok, _ := rl.allow("client"); ok {
+		t.Errorf("Second request after waiting for one token was allowed")
+	}
+
+	// Buckets never hold more than the burst.
+	now = now.Add(time.Hour)
+	for i := range 3 {
+		if ok, _ := rl.allow("client"); !ok {
+			t.Fatalf("Request %d of the refilled burst was refused", i+1)
+		}
+	}
+	if ok, _ := rl.allow("client"); ok {
+		t.Errorf("Request beyond the refilled burst was allowed")
+	}
+}
+
+func TestRateLimiter_Evict(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := newRateLimiter(1, 1)
+	rl.now = func() time.Time { return now }
+
+	rl.allow("idle")
+	now = now.Add(time.Second)
+	rl.allow("busy")
+
+	rl.evict(now)
+	if _, ok := rl.buckets["idle"]; ok {
+		t.Errorf("Refilled bucket was not evicted")
+	}
+	if _, ok := rl.buckets["busy"]; !ok {
+		t.Errorf("Bucket in use was evicted")
+	}
+}
+
+func TestClientID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/divide", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if got := clientID(r); got != "ip:192.0.2.1" {
+		t.Errorf("clientID() = %q, want %q", got, "ip:192.0.2.1")
+	}
+
+	// Keys which haven't been authenticated are ignored.
+	r.Header.Set(APIKeyHeader, "secret")
+	if got := clientID(r); got != "ip:192.0.2.1" {
+		t.Errorf("clientID() = %q, want %q", got, "ip:192.0.2.1")
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, "secret"))
+	if got := clientID(r); got != "key:secret" {
+		t.Errorf("clientID() = %q, want %q", got, "key:secret")
+	}
+}
+
+func TestShedLoad(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := shedLoad(1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	// Occupy the only slot.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/divide", nil))
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/divide", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header")
+	}
+
+	close(release)
+	<-done
+
+	// The slot is free again.
+	go func() { <-started }()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/divide", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status %d after the slot was released, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+// TestServer_RateLimitLoad floods the server from a single client and checks that only about
+// the burst gets through, while a second client is unaffected.
+func TestServer_RateLimitLoad(t *testing.T) {
+	const (
+		burst    = 10
+		requests = 100
+	)
+	server, err := New(WithRateLimit(1, burst), WithCredentials(Credential{Key: "a-client"}, Credential{Key: "another-client"}))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	var (
+		mu       sync.Mutex
+		statuses = map[int]int{}
+		wg       sync.WaitGroup
+	)
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/divide?a=10&b=3", nil)
+			req.Header.Set(APIKeyHeader, "a-client")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("Failed to make GET request: %v", err)
+				return
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+				t.Errorf("429 response without a Retry-After header")
+			}
+
+			mu.Lock()
+			statuses[resp.StatusCode]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// Allow for a token or two being replenished while the test runs.
+	if ok := statuses[http.StatusOK]; ok < burst || ok > burst+2 {
+		t.Errorf("Expected about %d successful requests, got %d", burst, ok)
+	}
+	if statuses[http.StatusOK]+statuses[http.StatusTooManyRequests] != requests {
+		t.Errorf("Unexpected statuses: %v", statuses)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/divide?a=10&b=3", nil)
+	req.Header.Set(APIKeyHeader, "another-client")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a different client to get status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+// TestServer_RateLimitRotatingKeys checks that a client can't get round its limit by sending a
+// different API key with each request when keys aren't authenticated.
+func TestServer_RateLimitRotatingKeys(t *testing.T) {
+	server, err := New(WithRateLimit(0.001, 1))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	statuses := map[int]int{}
+	for i := range 20 {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/divide?a=10&b=3", nil)
+		req.Header.Set(APIKeyHeader, fmt.Sprintf("key-%d", i))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		resp.Body.Close()
+		statuses[resp.StatusCode]++
+	}
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusTooManyRequests] != 19 {
+		t.Errorf("Expected only the first request to succeed, got %v", statuses)
+	}
+}
+
+func TestServer_RateLimitBadSignatures(t *testing.T) {
+	const burst = 3
+	good := Credential{Key: "a-client", Secret: []byte("secret")}
+	server, err := New(WithRateLimit(0.001, burst), WithCredentials(good, Credential{Key: "another-client"}))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	get := func(cred Credential) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/divide?a=10&b=3", nil)
+		if err := SignRequest(req, cred, time.Now()); err != nil {
+			t.Fatalf("SignRequest() error: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make GET request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Guessing at the secret fails authentication until the address runs out of allowance.
+	bad := Credential{Key: good.Key, Secret: []byte("guess")}
+	for i := range burst {
+		if resp := get(bad); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected bad signature %d to be refused with %d, got %d", i+1, http.StatusUnauthorized, resp.StatusCode)
+		}
+	}
+	resp := get(bad)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected status %d with a Retry-After header, got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+
+	// Until it's refilled, nothing more is authenticated from the address.
+	if resp := get(good); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for a correctly signed request, got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// JSONRPCVersion is the only version of JSON-RPC supported.
+	JSONRPCVersion = "2.0"
+
+	// maxRPCBodySize is the largest JSON-RPC request body accepted, including batches.
+	maxRPCBodySize = 1 << 20
+	// maxBatchSize is the most calls accepted in one batch.
+	maxBatchSize = 100
+	// maxRangeSize is the most numbers classifyRange will classify in one call.
+	maxRangeSize = 10000
+)
+
+// Standard JSON-RPC 2.0 error codes, and the server defined codes used by this API.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+
+	RPCDivisionByZero = -32000
+)
+
+// RPCRequest is a JSON-RPC 2.0 request. A request without an ID is a notification,
+// which the server doesn't respond to.
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// RPCResponse is a JSON-RPC 2.0 response, carrying either a result or an error.
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// RPCError is a JSON-RPC 2.0 error object.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// FizzBuzzResult is the result of the fizzbuzz and classifyRange methods.
+type FizzBuzzResult struct {
+	Number int    `json:"number"`
+	Fizz   bool   `json:"fizz"`
+	Buzz   bool   `json:"buzz"`
+	Output string `json:"output"` // "Fizz", "Buzz", "FizzBuzz" or the number.
+}
+
+// DivideParams are the parameters of the divide method, by name or as [a, b].
+type DivideParams struct {
+	A Number `json:"a"`
+	B Number `json:"b"`
+}
+
+// FizzBuzzParams are the parameters of the fizzbuzz method, by name or as [n].
+type FizzBuzzParams struct {
+	N int `json:"n"`
+}
+
+// ClassifyRangeParams are the parameters of the classifyRange method, by name or as [from, to].
+// Both ends of the range are included.
+type ClassifyRangeParams struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// rpcMethods maps method names to their implementations, which return a result or an *RPCError.
+var rpcMethods = map[string]func(params json.RawMessage) (any, *RPCError){
+	"divide": func(params json.RawMessage) (any, *RPCError) {
+		var p DivideParams
+		if err := decodeParams(params, &p, &p.A, &p.B); err != nil {
+			return nil, err
+		}
+		result, err := divide(p.A.Big(), p.B.Big())
+		if err != nil {
+			return nil, &RPCError{Code: RPCDivisionByZero, Message: "Division by zero is not allowed"}
+		}
+		return result, nil
+	},
+
+	"fizzbuzz": func(params json.RawMessage) (any, *RPCError) {
+		var p FizzBuzzParams
+		if err := decodeParams(params, &p, &p.N); err != nil {
+			return nil, err
+		}
+		return classify(p.N), nil
+	},
+
+	"classifyRange": func(params json.RawMessage) (any, *RPCError) {
+		var p ClassifyRangeParams
+		if err := decodeParams(params, &p, &p.From, &p.To); err != nil {
+			return nil, err
+		}
+		// The difference of far apart numbers overflows, but as an unsigned number it's still right
+		// once they're known to be in order.
+		if p.To < p.From || uint(p.To-p.From) >= maxRangeSize {
+			return nil, &RPCError{
+				Code:    RPCInvalidParams,
+				Message: fmt.Sprintf("Invalid params: range must be in order and hold at most %d numbers", maxRangeSize),
+			}
+		}
+		// Counting up to To would overflow and never stop when To is the largest int.
+		size := p.To - p.From + 1
+		results := make([]FizzBuzzResult, 0, size)
+		for i := range size {
+			results = append(results, classify(p.From+i))
+		}
+		return results, nil
+	},
+}
+
+// classify works out the FizzBuzz result for n, using the same division as /divide.
+func classify(n int) FizzBuzzResult {
+	byThree, _ := divide(big.NewInt(int64(n)), big.NewInt(3))
+	byFive, _ := divide(big.NewInt(int64(n)), big.NewInt(5))
+
+	result := FizzBuzzResult{
+		Number: n,
+		Fizz:   byThree.Remainder.IsZero(),
+		Buzz:   byFive.Remainder.IsZero(),
+	}
+	switch {
+	case result.Fizz && result.Buzz:
+		result.Output = "FizzBuzz"
+	case result.Fizz:
+		result.Output = "Fizz"
+	case result.Buzz:
+		result.Output = "Buzz"
+	default:
+		result.Output = strconv.Itoa(n)
+	}
+	return result
+}
+
+// decodeParams decodes params given by name into the struct v, or by position into the
+// fields, which must point into v in order.
+func decodeParams(params json.RawMessage, v any, fields ...any) *RPCError {
+	invalid := &RPCError{Code: RPCInvalidParams, Message: "Invalid params"}
+
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 {
+		return invalid
+	}
+
+	if params[0] == '[' {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(params, &positional); err != nil || len(positional) != len(fields) {
+			return invalid
+		}
+		for i, raw := range positional {
+			if err := json.Unmarshal(raw, fields[i]); err != nil {
+				return invalid
+			}
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return invalid
+	}
+	return nil
+}
+
+// call handles one JSON-RPC request, returning nil for notifications.
+func call(raw json.RawMessage) *RPCResponse {
+	var req RPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != JSONRPCVersion || req.Method == "" {
+		return &RPCResponse{
+			JSONRPC: JSONRPCVersion,
+			Error:   &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request"},
+			ID:      json.RawMessage("null"),
+		}
+	}
+
+	var (
+		result any
+		rpcErr *RPCError
+	)
+	if method, ok := rpcMethods[req.Method]; ok {
+		result, rpcErr = method(req.Params)
+	} else {
+		rpcErr = &RPCError{Code: RPCMethodNotFound, Message: "Method not found"}
+	}
+
+	if req.ID == nil {
+		return nil
+	}
+
+	resp := &RPCResponse{JSONRPC: JSONRPCVersion, Error: rpcErr, ID: req.ID}
+	if rpcErr == nil {
+		var err error
+		if resp.Result, err = json.Marshal(result); err != nil {
+			resp.Error = &RPCError{Code: RPCInternalError, Message: "Internal error"}
+		}
+	}
+	return resp
+}
+
+// handleRPC serves JSON-RPC 2.0 requests, individually or in batches. JSON-RPC errors are
+// reported in the response body with a 200 status, as the protocol expects.
+func handleRPC(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(v any) {
+		body, err := json.Marshal(v)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Internal Server Error")
+			return
+		}
+		w.Header().Set("Content-Type", FormatJSON.ContentType())
+		w.Write(body)
+	}
+	parseError := &RPCResponse{
+		JSONRPC: JSONRPCVersion,
+		Error:   &RPCError{Code: RPCParseError, Message: "Parse error"},
+		ID:      json.RawMessage("null"),
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRPCBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "Request body too large")
+			return
+		}
+		writeJSON(parseError)
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		writeJSON(parseError)
+		return
+	}
+
+	if body[0] != '[' {
+		if resp := call(body); resp != nil {
+			writeJSON(resp)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		writeJSON(parseError)
+		return
+	}
+	if len(batch) == 0 || len(batch) > maxBatchSize {
+		writeJSON(&RPCResponse{
+			JSONRPC: JSONRPCVersion,
+			Error:   &RPCError{Code: RPCInvalidRequest, Message: "Invalid Request"},
+			ID:      json.RawMessage("null"),
+		})
+		return
+	}
+
+	var responses []*RPCResponse
+	for _, raw := range batch {
+		if resp := call(raw); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		// A batch of notifications gets no response at all.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(responses)
+}
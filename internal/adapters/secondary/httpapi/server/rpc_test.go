@@ -0,0 +1,218 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleRPC(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Divide by name",
+			body:           `{"jsonrpc":"2.0","method":"divide","params":{"a":10,"b":3},"id":1}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","result":{"remainder":1},"id":1}`,
+		},
+		{
+			name:           "Divide by position",
+			body:           `{"jsonrpc":"2.0","method":"divide","params":[10,5],"id":"abc"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","result":{"remainder":0},"id":"abc"}`,
+		},
+		{
+			name:           "Division by zero",
+			body:           `{"jsonrpc":"2.0","method":"divide","params":{"a":10,"b":0},"id":2}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32000,"message":"Division by zero is not allowed"},"id":2}`,
+		},
+		{
+			name:           "FizzBuzz",
+			body:           `{"jsonrpc":"2.0","method":"fizzbuzz","params":[15],"id":3}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","result":{"number":15,"fizz":true,"buzz":true,"output":"FizzBuzz"},"id":3}`,
+		},
+		{
+			name:           "Classify range",
+			body:           `{"jsonrpc":"2.0","method":"classifyRange","params":{"from":4,"to":6},"id":4}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"jsonrpc":"2.0","result":[` +
+				`{"number":4,"fizz":false,"buzz":false,"output":"4"},` +
+				`{"number":5,"fizz":false,"buzz":true,"output":"Buzz"},` +
+				`{"number":6,"fizz":true,"buzz":false,"output":"Fizz"}],"id":4}`,
+		},
+		{
+			name:           "Classify range too large",
+			body:           `{"jsonrpc":"2.0","method":"classifyRange","params":[1,1000000],"id":5}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: range must be in order and hold at most 10000 numbers"},"id":5}`,
+		},
+		{
+			name:           "Classify range ending at the largest int",
+			body:           `{"jsonrpc":"2.0","method":"classifyRange","params":[9223372036854775805,9223372036854775807],"id":4}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"jsonrpc":"2.0","result":[` +
+				`{"number":9223372036854775805,"fizz":false,"buzz":true,"output":"Buzz"},` +
+				`{"number":9223372036854775806,"fizz":true,"buzz":false,"output":"Fizz"},` +
+				`{"number":9223372036854775807,"fizz":false,"buzz":false,"output":"9223372036854775807"}],"id":4}`,
+		},
+		{
+			name:           "Classify range starting at the smallest int",
+			body:           `{"jsonrpc":"2.0","method":"classifyRange","params":[-9223372036854775808,-9223372036854775806],"id":4}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"jsonrpc":"2.0","result":[` +
+				`{"number":-9223372036854775808,"fizz":false,"buzz":false,"output":"-9223372036854775808"},` +
+				`{"number":-9223372036854775807,"fizz":false,"buzz":false,"output":"-9223372036854775807"},` +
+				`{"number":-9223372036854775806,"fizz":true,"buzz":false,"output":"Fizz"}],"id":4}`,
+		},
+		{
+			name:           "Classify range of every int",
+			body:           `{"jsonrpc":"2.0","method":"classifyRange","params":[-9223372036854775808,9223372036854775807],"id":5}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: range must be in order and hold at most 10000 numbers"},"id":5}`,
+		},
+		{
+			name:           "Classify range out of order",
+			body:           `{"jsonrpc":"2.0","method":"classifyRange","params":[9223372036854775807,-9223372036854775808],"id":5}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params: range must be in order and hold at most 10000 numbers"},"id":5}`,
+		},
+		{
+			name:           "Invalid params",
+			body:           `{"jsonrpc":"2.0","method":"divide","params":{"a":"ten","b":3},"id":6}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":6}`,
+		},
+		{
+			name:           "Unknown params",
+			body:           `{"jsonrpc":"2.0","method":"divide","params":{"a":10,"c":3},"id":7}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":7}`,
+		},
+		{
+			name:           "Wrong number of positional params",
+			body:           `{"jsonrpc":"2.0","method":"divide","params":[10],"id":8}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":8}`,
+		},
+		{
+			name:           "Method not found",
+			body:           `{"jsonrpc":"2.0","method":"multiply","params":[1,2],"id":9}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":9}`,
+		},
+		{
+			name:           "Parse error",
+			body:           `{"jsonrpc":"2.0","method":"divide","params":[10,3],"id":1`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		{
+			name:           "Invalid request",
+			body:           `{"jsonrpc":"1.0","method":"divide","params":[10,3],"id":1}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name:           "Notification",
+			body:           `{"jsonrpc":"2.0","method":"divide","params":[10,3]}`,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "Batch",
+			body: `[
+				{"jsonrpc":"2.0","method":"divide","params":[10,3],"id":1},
+				{"jsonrpc":"2.0","method":"divide","params":[10,3]},
+				{"jsonrpc":"2.0","method":"nope","id":2},
+				1
+			]`,
+			expectedStatus: http.StatusOK,
+			expectedBody: `[` +
+				`{"jsonrpc":"2.0","result":{"remainder":1},"id":1},` +
+				`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":2},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}]`,
+		},
+		{
+			name:           "Batch of notifications",
+			body:           `[{"jsonrpc":"2.0","method":"divide","params":[10,3]},{"jsonrpc":"2.0","method":"fizzbuzz","params":[3]}]`,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "Empty batch",
+			body:           `[]`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		{
+			name:           "Batch too large",
+			body:           "[" + strings.Repeat(`{"jsonrpc":"2.0","method":"fizzbuzz","params":[3],"id":1},`, maxBatchSize) + `1]`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handle(rec, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedBody == "" {
+				if rec.Body.Len() != 0 {
+					t.Errorf("Expected no body, got %s", rec.Body.String())
+				}
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Expected Content-Type application/json, got %q", got)
+			}
+			if rec.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_RPC(t *testing.T) {
+	server, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/rpc", "application/json",
+		strings.NewReader(`{"jsonrpc":"2.0","method":"divide","params":[10,3],"id":1}`))
+	if err != nil {
+		t.Fatalf("Failed to make POST request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var rpcResp RPCResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rpcResp.Error != nil || string(rpcResp.Result) != `{"remainder":1}` {
+		t.Errorf("Unexpected response %+v", rpcResp)
+	}
+
+	// Only POST is allowed.
+	resp, err = http.Get(server.URL + "/rpc")
+	if err != nil {
+		t.Fatalf("Failed to make GET request: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
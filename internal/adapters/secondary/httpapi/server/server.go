@@ -1,19 +1,27 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
-	"strconv"
+	"os"
+	"sync/atomic"
+	"time"
 )
 
 type DivisionResult struct {
-	Remainder int `json:"remainder"`
+	Remainder Number `json:"remainder" xml:"remainder"`
 }
 
+// ErrorResult is the legacy error response, still served to clients which don't accept Problem Details.
 type ErrorResult struct {
-	Message string `json:"message"`
+	Message string `json:"message" xml:"message"`
 }
 
 // newErrorJSON creates a JSON error response with the given message.
@@ -28,78 +36,248 @@ func newErrorJSON(message string) []byte {
 	return errorJSON
 }
 
-// getIntFromQuery retrieves an integer parameter from the query string.
-func getIntFromQuery(q url.Values, param string) (int, error) {
-	value, err := strconv.Atoi(q.Get(param))
+// writeResult encodes v in the given format and writes it with the status code.
+// If v cannot be encoded a JSON internal server error is written instead.
+func writeResult(w http.ResponseWriter, format Format, statusCode int, v any) {
+	body, err := format.Marshal(v)
 	if err != nil {
-		return 0, err
+		w.Header().Set("Content-Type", FormatJSON.ContentType())
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(newErrorJSON("Failed to encode response"))
+		return
 	}
-	return value, nil
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(statusCode)
+	w.Write(body)
 }
 
-// New creates a new HTTP test server for handling requests.
-func New() *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var (
-			errorJSON  []byte
-			resultJSON []byte
-			statusCode = http.StatusBadRequest
-		)
-
-		defer func() {
-			w.Header().Set("Content-Type", "application/json")
-
-			switch {
-			case len(errorJSON) > 0:
-				w.WriteHeader(statusCode)
-				w.Write(errorJSON) // if errorJSON is nil, it will write "{}"
-
-			case statusCode == http.StatusOK:
-				w.Write(resultJSON) // if resultJSON is nil, it will write "{}"
-
-			default:
-				// Safety net, it shouldn't be possible to reach here.
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write(newErrorJSON("Internal Server Error"))
-			}
-		}()
-
-		switch r.URL.Path {
-		case "/divide":
-			a, err := getIntFromQuery(r.URL.Query(), "a")
-			if err != nil {
-				errorJSON = newErrorJSON("Invalid query parameter: 'a'")
-				statusCode = http.StatusBadRequest
-				return
-			}
-
-			b, err := getIntFromQuery(r.URL.Query(), "b")
-			if err != nil {
-				errorJSON = newErrorJSON("Invalid query parameter: 'b'")
-				statusCode = http.StatusBadRequest
-				return
-			}
-
-			if b == 0 {
-				errorJSON = newErrorJSON("Division by zero is not allowed")
-				statusCode = http.StatusBadRequest
-				return
-			}
-
-			result := DivisionResult{
-				Remainder: a % b,
-			}
-			statusCode = http.StatusOK
-
-			resultJSON, err = json.Marshal(result)
-			if err != nil {
-				errorJSON = newErrorJSON("Failed to marshal JSON")
-				statusCode = http.StatusInternalServerError
-			}
+// getNumberFromQuery retrieves an arbitrary-precision integer parameter from the query string.
+func getNumberFromQuery(q url.Values, param string) (*big.Int, error) {
+	value, err := ParseNumber(q.Get(param))
+	if err != nil {
+		return nil, err
+	}
+	return value.Big(), nil
+}
+
+// requestFormat returns the format negotiated for a request, falling back to JSON if the
+// client accepts none of the supported formats.
+func requestFormat(r *http.Request) Format {
+	if format, ok := Negotiate(r.Header.Get("Accept")); ok {
+		return format
+	}
+	return FormatJSON
+}
+
+// config holds the settings applied by Options.
+type config struct {
+	rateLimit     float64 // Requests per second allowed per client, 0 for no limit.
+	rateBurst     int
+	maxConcurrent int // Requests handled at once across all clients, 0 for no limit.
+	credentials   []Credential
+
+	tlsCert                 *tls.Certificate
+	tlsCertFile, tlsKeyFile string
+	tlsSelfSigned           bool
+	clientCAs               *x509.CertPool
+
+	drainDelay time.Duration
+	faults     *Faults
+
+	corsOrigins []string
+
+	socketPath string
+	socketMode os.FileMode
+
+	h2c bool
+
+	compress        bool
+	compressMinSize int
+}
+
+// Option configures the server created by New.
+type Option func(*config)
+
+// Server is a running divide server.
+type Server struct {
+	*httptest.Server
+
+	ready      atomic.Bool
+	drainDelay time.Duration
+}
+
+// New creates and starts a new HTTP test server for handling requests.
+// Responses are encoded in the format negotiated from the request's Accept header.
+// The server uses HTTPS if any of the TLS options are supplied, and listens on TCP loopback
+// unless WithUnixSocket is supplied.
+func New(opts ...Option) (*Server, error) {
+	cfg := config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	s := &Server{
+		drainDelay: cfg.drainDelay,
+	}
+
+	var handler http.Handler = http.HandlerFunc(handle)
+	if cfg.faults != nil {
+		handler = injectFaults(newFaultInjector(*cfg.faults), handler)
+	}
+	if cfg.rateLimit > 0 {
+		handler = rateLimit(newRateLimiter(cfg.rateLimit, cfg.rateBurst), handler)
+	}
+	// Authentication runs before rate limiting by key, so clients can't spend each other's
+	// allowance by presenting someone else's API key. Failed authentications are limited by IP
+	// address instead, before the key and signature are checked.
+	if len(cfg.credentials) > 0 {
+		a := newAuthenticator(cfg.credentials)
+		if cfg.rateLimit > 0 {
+			a.failures = newRateLimiter(cfg.rateLimit, cfg.rateBurst)
+		}
+		handler = authenticate(a, handler)
+	}
+	if cfg.maxConcurrent > 0 {
+		handler = shedLoad(cfg.maxConcurrent, handler)
+	}
+
+	// Probes are kept apart from the API, so that orchestrators don't need credentials and
+	// aren't rate limited.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.HandleFunc("/version", handleVersion)
+	mux.Handle("/", handler)
+
+	handler = allowMethods(mux)
+	if len(cfg.corsOrigins) > 0 {
+		handler = cors(cfg.corsOrigins, handler)
+	}
+	if cfg.compress {
+		handler = compress(cfg.compressMinSize, handler)
+	}
+
+	// Every request gets an ID, an access log line and protection from panics, whether or not
+	// it's rejected by the handlers above.
+	handler = withRequestID(logRequests(recoverPanics(handler)))
+
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Server = httptest.NewUnstartedServer(handler)
+	if cfg.socketPath != "" {
+		// Swap the loopback listener httptest created for the socket.
+		l, err := listenUnix(cfg.socketPath, cfg.socketMode)
+		s.Listener.Close()
+		if err != nil {
+			return nil, err
+		}
+		s.Listener = l
+	}
+	if cfg.h2c {
+		s.Config.Protocols = h2cProtocols()
+		s.EnableHTTP2 = true
+	}
+	if tlsConfig == nil {
+		s.Start()
+	} else {
+		s.TLS = tlsConfig
+		s.StartTLS()
+	}
+	if cfg.socketPath != "" {
+		s.useUnixSocket(cfg.socketPath)
+	}
+	if cfg.h2c {
+		s.Client().Transport.(*http.Transport).Protocols = H2CClientProtocols()
+	}
+	s.ready.Store(true)
+	return s, nil
+}
+
+// Close stops the server. Readiness checks fail from the moment it's called, and if a drain delay
+// is configured the server carries on serving for that long, giving load balancers time to notice.
+func (s *Server) Close() {
+	s.ready.Store(false)
+	time.Sleep(s.drainDelay)
+	s.Server.Close()
+}
+
+// errDivisionByZero is returned by divide when the divisor is zero.
+var errDivisionByZero = errors.New("division by zero")
+
+// divide performs the division behind both the REST and JSON-RPC APIs.
+// The remainder has the sign of a, as with Go's % operator.
+func divide(a, b *big.Int) (DivisionResult, error) {
+	if b.Sign() == 0 {
+		return DivisionResult{}, errDivisionByZero
+	}
+	return DivisionResult{Remainder: NewBigNumber(new(big.Int).Rem(a, b))}, nil
+}
+
+// handle serves the divide API.
+func handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/rpc" {
+		// JSON-RPC has its own error handling, and always responds in JSON.
+		handleRPC(w, r)
+		return
+	}
+
+	var (
+		errorCode    string
+		errorMessage string
+		result       DivisionResult
+		statusCode   = http.StatusBadRequest
+	)
+
+	format, ok := Negotiate(r.Header.Get("Accept"))
+	if !ok {
+		writeError(w, r, http.StatusNotAcceptable, CodeNotAcceptable, fmt.Sprintf("Not Acceptable: supported formats are %s, %s, %s and %s",
+			FormatJSON, FormatXML, FormatText, FormatCBOR))
+		return
+	}
+
+	defer func() {
+		switch {
+		case errorMessage != "":
+			writeError(w, r, statusCode, errorCode, errorMessage)
+
+		case statusCode == http.StatusOK:
+			writeCacheableResult(w, r, format, result)
 
 		default:
-			errorJSON = newErrorJSON("Unsupported path")
-			statusCode = http.StatusNotFound
+			// Safety net, it shouldn't be possible to reach here.
+			writeError(w, r, http.StatusInternalServerError, CodeInternal, "Internal Server Error")
+		}
+	}()
+
+	switch r.URL.Path {
+	case "/divide":
+		a, err := getNumberFromQuery(r.URL.Query(), "a")
+		if err != nil {
+			errorCode, errorMessage = CodeInvalidParam, "Invalid query parameter: 'a'"
+			statusCode = http.StatusBadRequest
+			return
 		}
-	}))
+
+		b, err := getNumberFromQuery(r.URL.Query(), "b")
+		if err != nil {
+			errorCode, errorMessage = CodeInvalidParam, "Invalid query parameter: 'b'"
+			statusCode = http.StatusBadRequest
+			return
+		}
+
+		result, err = divide(a, b)
+		if err != nil {
+			errorCode, errorMessage = CodeDivisionByZero, "Division by zero is not allowed"
+			statusCode = http.StatusBadRequest
+			return
+		}
+		statusCode = http.StatusOK
+
+	default:
+		errorCode, errorMessage = CodeNotFound, "Unsupported path"
+		statusCode = http.StatusNotFound
+	}
 }
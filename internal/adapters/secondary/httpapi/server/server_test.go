@@ -5,11 +5,15 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 )
 
 func TestServer(t *testing.T) {
-	server := New()
+	server, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
 	defer server.Close()
 
 	tests := []struct {
@@ -40,6 +44,34 @@ func TestServer(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `{"message":"Invalid query parameter: 'b'"}`,
 		},
+		{
+			name:           "Negative dividend keeps its sign",
+			path:           "/divide",
+			queryParams:    url.Values{"a": {"-10"}, "b": {"3"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"remainder":-1}`,
+		},
+		{
+			name:           "128-bit inputs",
+			path:           "/divide",
+			queryParams:    url.Values{"a": {"340282366920938463463374607431768211455"}, "b": {"18446744073709551616"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"remainder":"18446744073709551615"}`,
+		},
+		{
+			name:           "Remainder within the JSON safe integer range",
+			path:           "/divide",
+			queryParams:    url.Values{"a": {"340282366920938463463374607431768211455"}, "b": {"9007199254740992"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"remainder":9007199254740991}`,
+		},
+		{
+			name:           "Too many digits",
+			path:           "/divide",
+			queryParams:    url.Values{"a": {strings.Repeat("9", maxNumberDigits+1)}, "b": {"3"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"message":"Invalid query parameter: 'a'"}`,
+		},
 		{
 			name:           "Division by zero",
 			path:           "/divide",
@@ -101,3 +133,94 @@ func TestServer(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_ContentNegotiation(t *testing.T) {
+	server, err := New()
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	tests := []struct {
+		name                string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        []byte
+	}{
+		{
+			name:                "No Accept header defaults to JSON",
+			accept:              "",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/json",
+			expectedBody:        []byte(`{"remainder":1}`),
+		},
+		{
+			name:                "XML",
+			accept:              "application/xml",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/xml",
+			expectedBody:        []byte(`<DivisionResult><remainder>1</remainder></DivisionResult>`),
+		},
+		{
+			name:                "Plain text",
+			accept:              "text/plain",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        []byte("remainder=1\n"),
+		},
+		{
+			name:                "CBOR",
+			accept:              "application/cbor",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/cbor",
+			expectedBody:        []byte{0xa1, 0x69, 'r', 'e', 'm', 'a', 'i', 'n', 'd', 'e', 'r', 0x01},
+		},
+		{
+			name:                "Preference by quality",
+			accept:              "application/json;q=0.5, application/cbor;q=0.9",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "application/cbor",
+			expectedBody:        []byte{0xa1, 0x69, 'r', 'e', 'm', 'a', 'i', 'n', 'd', 'e', 'r', 0x01},
+		},
+		{
+			name:                "Unsupported type",
+			accept:              "image/png",
+			expectedStatus:      http.StatusNotAcceptable,
+			expectedContentType: "application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/divide?a=10&b=3", nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to make GET request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read response body: %v", err)
+			}
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedContentType, got)
+			}
+			if tt.expectedBody != nil && string(body) != string(tt.expectedBody) {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// defaultSocketMode only lets the server's own user connect to its socket.
+	defaultSocketMode os.FileMode = 0o600
+
+	// socketProbeTimeout is how long to wait when checking whether an existing socket is in use.
+	socketProbeTimeout = time.Second
+)
+
+// WithUnixSocket makes the server listen on a Unix domain socket at path, instead of TCP loopback,
+// for clients on the same host such as sidecars. The socket's permissions are set to mode, or
+// 0600 if it's zero. A socket left behind by a server which didn't shut down cleanly is removed,
+// but New fails if another server is listening on the path or it's some other kind of file.
+//
+// The server's URL uses the host "localhost", which its client dials through the socket.
+func WithUnixSocket(path string, mode os.FileMode) Option {
+	return func(cfg *config) {
+		cfg.socketPath = path
+		cfg.socketMode = mode
+	}
+}
+
+// DialUnix returns a DialContext function for an http.Transport which connects to the Unix domain
+// socket at path, whatever address it's asked for.
+func DialUnix(path string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", path)
+	}
+}
+
+// listenUnix listens on a Unix domain socket at path, removing any stale socket first.
+// Closing the listener removes the socket.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if mode == 0 {
+		mode = defaultSocketMode
+	}
+
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil:
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s already exists and is not a socket", path)
+		}
+		conn, err := net.DialTimeout("unix", path, socketProbeTimeout)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("failed to check socket path: %w", err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket: %w", err)
+	}
+	// There's a moment before this when the socket has the default permissions, so sockets that
+	// need protecting should be in a directory other users can't reach.
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return l, nil
+}
+
+// useUnixSocket points a started server's URL and client at its socket.
+func (s *Server) useUnixSocket(path string) {
+	if s.TLS != nil {
+		s.URL = "https://localhost"
+	} else {
+		s.URL = "http://localhost"
+	}
+	s.Client().Transport.(*http.Transport).DialContext = DialUnix(path)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// socketPath returns a path for a socket in a new temporary directory. The directory is kept short,
+// as socket paths are limited to around 100 bytes.
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "divide")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "divide.sock")
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "HTTP"},
+		{name: "HTTPS", opts: []Option{WithSelfSignedTLS()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := socketPath(t)
+			server, err := New(append(tt.opts, WithUnixSocket(path, 0o660))...)
+			if err != nil {
+				t.Fatalf("New() error: %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Expected a socket at %s: %v", path, err)
+			}
+			if info.Mode().Type() != os.ModeSocket || info.Mode().Perm() != 0o660 {
+				t.Errorf("Expected a socket with mode 0660, got %v", info.Mode())
+			}
+
+			resp, err := server.Client().Get(server.URL + "/divide?a=10&b=3")
+			if err != nil {
+				t.Fatalf("Failed to make GET request: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != `{"remainder":1}` {
+				t.Errorf("Expected body %s, got %s", `{"remainder":1}`, body)
+			}
+
+			server.Close()
+			if _, err := os.Lstat(path); !os.IsNotExist(err) {
+				t.Errorf("Expected the socket to be removed on close, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServer_UnixSocket_DefaultMode(t *testing.T) {
+	path := socketPath(t)
+	server, err := New(WithUnixSocket(path, 0))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != defaultSocketMode {
+		t.Errorf("Expected mode %v, got %v, %v", defaultSocketMode, info.Mode().Perm(), err)
+	}
+}
+
+func TestServer_UnixSocket_ExistingPath(t *testing.T) {
+	t.Run("Stale socket is removed", func(t *testing.T) {
+		path := socketPath(t)
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		// Leave the socket behind, as a crashed server would.
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+
+		server, err := New(WithUnixSocket(path, 0))
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		server.Close()
+	})
+
+	t.Run("Socket in use", func(t *testing.T) {
+		path := socketPath(t)
+		first, err := New(WithUnixSocket(path, 0))
+		if err != nil {
+			t.Fatalf("New() error: %v", err)
+		}
+		defer first.Close()
+
+		if _, err := New(WithUnixSocket(path, 0)); err == nil || !strings.Contains(err.Error(), "in use") {
+			t.Errorf("Expected an in use error, got %v", err)
+		}
+	})
+
+	t.Run("Not a socket", func(t *testing.T) {
+		path := socketPath(t)
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		if _, err := New(WithUnixSocket(path, 0)); err == nil || !strings.Contains(err.Error(), "not a socket") {
+			t.Errorf("Expected a not a socket error, got %v", err)
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+			t.Errorf("Expected the file to be left alone, got %q, %v", data, err)
+		}
+	})
+}
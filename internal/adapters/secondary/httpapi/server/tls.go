@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// selfSignedValidity is how long generated certificates are valid for.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// WithTLS serves HTTPS using the certificate.
+func WithTLS(cert tls.Certificate) Option {
+	return func(cfg *config) {
+		cfg.tlsCert = &cert
+	}
+}
+
+// WithTLSFiles serves HTTPS using a PEM encoded certificate and key loaded from files.
+func WithTLSFiles(certFile, keyFile string) Option {
+	return func(cfg *config) {
+		cfg.tlsCertFile, cfg.tlsKeyFile = certFile, keyFile
+	}
+}
+
+// WithSelfSignedTLS serves HTTPS using a self-signed certificate generated when the server starts.
+// The server's Client trusts the certificate, and other clients can fetch it from Certificate.
+func WithSelfSignedTLS() Option {
+	return func(cfg *config) {
+		cfg.tlsSelfSigned = true
+	}
+}
+
+// WithClientCAs requires clients to present a certificate signed by one of the CAs (mutual TLS).
+// HTTPS is served with a self-signed certificate unless another is configured.
+func WithClientCAs(pool *x509.CertPool) Option {
+	return func(cfg *config) {
+		cfg.clientCAs = pool
+	}
+}
+
+// tlsConfig builds the server's TLS configuration, or returns nil if it should serve plain HTTP.
+func (cfg *config) tlsConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	switch {
+	case cfg.tlsCert != nil:
+		cert = *cfg.tlsCert
+
+	case cfg.tlsCertFile != "" || cfg.tlsKeyFile != "":
+		var err error
+		if cert, err = tls.LoadX509KeyPair(cfg.tlsCertFile, cfg.tlsKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+
+	case cfg.tlsSelfSigned || cfg.clientCAs != nil:
+		var err error
+		if cert, err = SelfSignedCertificate(); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.clientCAs != nil {
+		tlsConfig.ClientCAs = cfg.clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// SelfSignedCertificate generates a self-signed server certificate for localhost, the loopback
+// addresses and any additional host names or IP addresses.
+func SelfSignedCertificate(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "fizzbuzz divide server"},
+		NotBefore:    now.Add(-time.Hour), // Allow for clock skew.
+		NotAfter:     now.Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server/servertest"
+)
+
+// getDivide makes a divide request with the client and returns the status code.
+func getDivide(client *http.Client, baseURL string) (int, error) {
+	resp, err := client.Get(baseURL + "/divide?a=10&b=3")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestServer_SelfSignedTLS(t *testing.T) {
+	server, err := New(WithSelfSignedTLS())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	if !strings.HasPrefix(server.URL, "https://") {
+		t.Fatalf("Expected an https URL, got %s", server.URL)
+	}
+	if server.Certificate().Subject.CommonName != "fizzbuzz divide server" {
+		t.Errorf("Expected the generated certificate, got one for %q", server.Certificate().Subject.CommonName)
+	}
+
+	if status, err := getDivide(server.Client(), server.URL); err != nil || status != http.StatusOK {
+		t.Errorf("Expected status %d, got %d and error %v", http.StatusOK, status, err)
+	}
+
+	// Clients which don't trust the certificate can't connect.
+	if _, err := getDivide(&http.Client{}, server.URL); err == nil {
+		t.Errorf("Expected an error from a client which doesn't trust the certificate")
+	}
+}
+
+func TestServer_TLSFiles(t *testing.T) {
+	cert, err := SelfSignedCertificate("divide.example.com")
+	if err != nil {
+		t.Fatalf("SelfSignedCertificate() error: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	server, err := New(WithTLSFiles(certFile, keyFile))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	if got := server.Certificate().DNSNames; len(got) != 2 || got[1] != "divide.example.com" {
+		t.Errorf("Expected the certificate from the file, got DNS names %v", got)
+	}
+	if status, err := getDivide(server.Client(), server.URL); err != nil || status != http.StatusOK {
+		t.Errorf("Expected status %d, got %d and error %v", http.StatusOK, status, err)
+	}
+
+	if _, err := New(WithTLSFiles(filepath.Join(dir, "missing.pem"), keyFile)); err == nil {
+		t.Errorf("Expected an error for a missing certificate file")
+	}
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	pool, clientCert := servertest.NewTestCA(t)
+
+	server, err := New(WithClientCAs(pool))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	defer server.Close()
+
+	// The server's own client trusts the server, but has no client certificate.
+	if _, err := getDivide(server.Client(), server.URL); err == nil {
+		t.Errorf("Expected an error from a client without a certificate")
+	}
+
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+	client := &http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+
+	if status, err := getDivide(client, server.URL); err != nil || status != http.StatusOK {
+		t.Errorf("Expected status %d, got %d and error %v", http.StatusOK, status, err)
+	}
+
+	// A certificate from another CA is refused.
+	_, otherCert := servertest.NewTestCA(t)
+	transport = transport.Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{otherCert}
+	if _, err := getDivide(&http.Client{Transport: transport}, server.URL); err == nil {
+		t.Errorf("Expected an error from a client with an untrusted certificate")
+	}
+}
@@ -0,0 +1,95 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server"
+)
+
+// respondFunc answers a call to a testServer. Calls are numbered from 1.
+type respondFunc func(call int32, w http.ResponseWriter, r *http.Request)
+
+// testServer is a scriptable stand-in for the divide server, which answers each call with its
+// respondFunc and counts the calls it has had, and those the client gave up on.
+type testServer struct {
+	*httptest.Server
+	calls     atomic.Int32
+	cancelled atomic.Int32
+}
+
+// newTestServer starts a testServer, stopping it when the test ends.
+func newTestServer(t *testing.T, respond respondFunc) *testServer {
+	t.Helper()
+
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond(s.calls.Add(1), w, r)
+		if r.Context().Err() != nil {
+			s.cancelled.Add(1)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// divideServer answers as the embedded divide server does with the options, which can inject
+// faults with server.WithFaults.
+func divideServer(t *testing.T, opts ...server.Option) respondFunc {
+	t.Helper()
+
+	srv, err := server.New(opts...)
+	if err != nil {
+		t.Fatalf("server.New() error: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return func(_ int32, w http.ResponseWriter, r *http.Request) {
+		srv.Config.Handler.ServeHTTP(w, r)
+	}
+}
+
+// injectFault answers every call with the fault chosen by setting its probability to 1, such as
+// server.Faults{ServerError: 1}.
+func injectFault(t *testing.T, fault server.Faults) respondFunc {
+	t.Helper()
+	return divideServer(t, server.WithFaults(fault))
+}
+
+// inTurn answers each call with the next of the responses, and the calls after them with then.
+func inTurn(then respondFunc, responses ...respondFunc) respondFunc {
+	return func(call int32, w http.ResponseWriter, r *http.Request) {
+		if int(call) <= len(responses) {
+			responses[call-1](call, w, r)
+			return
+		}
+		then(call, w, r)
+	}
+}
+
+// withStatus answers with a legacy error with the status, whose message is the status text, and
+// a Retry-After header if retryAfter isn't empty.
+func withStatus(status int, retryAfter string) respondFunc {
+	return func(_ int32, w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(server.ErrorResult{Message: http.StatusText(status)})
+	}
+}
+
+// holdUntil holds each call until release is closed, then answers with then. Calls held on a nil
+// channel are held until the client gives up.
+func holdUntil(release <-chan struct{}, then respondFunc) respondFunc {
+	return func(call int32, w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			then(call, w, r)
+		case <-r.Context().Done():
+		}
+	}
+}
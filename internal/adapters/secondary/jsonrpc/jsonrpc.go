@@ -0,0 +1,194 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server"
+)
+
+const (
+	maxResponseSize = 64 * 1024 // 64 KB is the maximum supported response size, enough for batches.
+	rpcPath         = "%s/rpc"
+)
+
+// RPC is a FizzBuzzer which calls the divide server's JSON-RPC 2.0 endpoint.
+type RPC struct {
+	server *httptest.Server
+	ctx    context.Context
+	wg     *sync.WaitGroup
+	nextID atomic.Int64
+
+	credentials *server.Credential
+	serverOpts  []server.Option
+}
+
+// Option configures an RPC instance created by New.
+type Option func(*RPC)
+
+// WithCredentials makes the RPC send an API key with every request, and sign them with the
+// secret if it isn't empty. The embedded server is configured to require the same credentials.
+func WithCredentials(key string, secret []byte) Option {
+	return func(rpc *RPC) {
+		cred := server.Credential{Key: key, Secret: secret}
+		rpc.credentials = &cred
+		rpc.serverOpts = append(rpc.serverOpts, server.WithCredentials(cred))
+	}
+}
+
+// WithServerOptions configures the embedded divide server.
+func WithServerOptions(opts ...server.Option) Option {
+	return func(rpc *RPC) {
+		rpc.serverOpts = append(rpc.serverOpts, opts...)
+	}
+}
+
+// New creates a new RPC instance with an embedded divide server.
+// The caller should supply a context to control when the server should be closed, or the function will create one for you.
+// The caller is responsible for calling the returned cancel function to cleanly stop the server,
+// and should wait on the supplied WaitGroup to ensure all the server has stopped.
+func New(ctx context.Context, wg *sync.WaitGroup, opts ...Option) (*RPC, context.CancelFunc, error) {
+	if wg == nil {
+		return nil, nil, fmt.Errorf("wait group cannot be nil")
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	rpc := &RPC{
+		ctx: ctx,
+		wg:  wg,
+	}
+	for _, opt := range opts {
+		opt(rpc)
+	}
+
+	srv, err := server.New(rpc.serverOpts...)
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("failed to start server: %w", err)
+	}
+	rpc.server = srv.Server
+
+	rpc.wg.Add(1)
+	go func() {
+		defer rpc.wg.Done()
+
+		<-rpc.ctx.Done()
+		srv.Close()
+	}()
+
+	return rpc, cancel, nil
+}
+
+// Fizz implements the repository.FizzBuzzer interface.
+// Errors are logged and result in a false return value.
+func (rpc *RPC) Fizz(in int) bool {
+	return rpc.commonDivide(in, 3)
+}
+
+// Buzz implements the repository.FizzBuzzer interface.
+// Errors are logged and result in a false return value.
+func (rpc *RPC) Buzz(in int) bool {
+	return rpc.commonDivide(in, 5)
+}
+
+func (rpc *RPC) commonDivide(in int, divisor int) bool {
+	var result server.DivisionResult
+	if err := rpc.Call("divide", server.DivideParams{A: server.NewNumber(int64(in)), B: server.NewNumber(int64(divisor))}, &result); err != nil {
+		slog.Error("Error calling divide RPC", slog.String("error", err.Error()))
+		return false
+	}
+	return result.Remainder.IsZero()
+}
+
+// ClassifyRange asks the server to classify every number from "from" to "to", inclusive, in one call.
+func (rpc *RPC) ClassifyRange(from, to int) ([]server.FizzBuzzResult, error) {
+	var results []server.FizzBuzzResult
+	if err := rpc.Call("classifyRange", server.ClassifyRangeParams{From: from, To: to}, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Call calls a JSON-RPC method and decodes its result into the value pointed to by result.
+// Errors reported by the server are returned as *server.RPCError.
+func (rpc *RPC) Call(method string, params, result any) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode params: %w", err)
+	}
+	id, err := json.Marshal(rpc.nextID.Add(1))
+	if err != nil {
+		return fmt.Errorf("failed to encode id: %w", err)
+	}
+	body, err := json.Marshal(server.RPCRequest{
+		JSONRPC: server.JSONRPCVersion,
+		Method:  method,
+		Params:  rawParams,
+		ID:      id,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(rpc.ctx, http.MethodPost, fmt.Sprintf(rpcPath, rpc.server.URL), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, "+server.ProblemContentType)
+	if rpc.credentials != nil {
+		if err := server.SignRequest(req, *rpc.credentials, time.Now()); err != nil {
+			return fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
+
+	resp, err := rpc.server.Client().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read response body on response status %s: %w", resp.Status, err)
+	}
+	if len(bodyBytes) > maxResponseSize {
+		return fmt.Errorf("response too large: more than %d bytes", maxResponseSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Errors outside JSON-RPC, such as failed authentication, are reported as Problem Details.
+		var problem server.Problem
+		if err := json.Unmarshal(bodyBytes, &problem); err != nil {
+			return fmt.Errorf("unexpected status code: %s", resp.Status)
+		}
+		return fmt.Errorf("%s: %s", resp.Status, problem.Detail)
+	}
+
+	var rpcResp server.RPCResponse
+	if err := json.Unmarshal(bodyBytes, &rpcResp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if !bytes.Equal(rpcResp.ID, id) {
+		return fmt.Errorf("response id %s does not match request id %s", rpcResp.ID, id)
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+		return fmt.Errorf("failed to decode result: %w", err)
+	}
+	return nil
+}
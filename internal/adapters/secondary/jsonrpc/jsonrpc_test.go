@@ -0,0 +1,147 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/internal/adapters/secondary/httpapi/server"
+)
+
+// newTestRPC creates an RPC instance and stops its server when the test ends.
+func newTestRPC(t *testing.T, opts ...Option) *RPC {
+	t.Helper()
+
+	wg := &sync.WaitGroup{}
+	rpc, cancel, err := New(context.Background(), wg, opts...)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	return rpc
+}
+
+func TestNew(t *testing.T) {
+	if _, _, err := New(context.Background(), nil); err == nil {
+		t.Errorf("New() with a nil wait group gotErr = nil, expected an error")
+	}
+
+	wg := &sync.WaitGroup{}
+	rpc, cancel, err := New(nil, wg)
+	if err != nil {
+		t.Fatalf("New() with a nil context gotErr = %v, expected no error", err)
+	}
+	if rpc == nil || cancel == nil {
+		t.Fatalf("New() returned a nil RPC or cancel function")
+	}
+	cancel()
+	wg.Wait()
+}
+
+func TestRPC_FizzAndBuzz(t *testing.T) {
+	rpc := newTestRPC(t)
+
+	tests := []struct {
+		in         int
+		fizz, buzz bool
+	}{
+		{in: 1},
+		{in: 3, fizz: true},
+		{in: 5, buzz: true},
+		{in: 15, fizz: true, buzz: true},
+		{in: -9, fizz: true},
+	}
+	for _, tt := range tests {
+		if got := rpc.Fizz(tt.in); got != tt.fizz {
+			t.Errorf("Fizz(%d) = %v, want %v", tt.in, got, tt.fizz)
+		}
+		if got := rpc.Buzz(tt.in); got != tt.buzz {
+			t.Errorf("Buzz(%d) = %v, want %v", tt.in, got, tt.buzz)
+		}
+	}
+}
+
+func TestRPC_ClassifyRange(t *testing.T) {
+	rpc := newTestRPC(t)
+
+	results, err := rpc.ClassifyRange(1, 15)
+	if err != nil {
+		t.Fatalf("ClassifyRange() error: %v", err)
+	}
+	var outputs []string
+	for _, r := range results {
+		outputs = append(outputs, r.Output)
+	}
+	want := "1 2 Fizz 4 Buzz Fizz 7 8 Fizz Buzz 11 Fizz 13 14 FizzBuzz"
+	if got := strings.Join(outputs, " "); got != want {
+		t.Errorf("ClassifyRange(1, 15) = %q, want %q", got, want)
+	}
+}
+
+func TestRPC_Call_Errors(t *testing.T) {
+	rpc := newTestRPC(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		params   any
+		wantCode int
+	}{
+		{name: "Division by zero", method: "divide", params: server.DivideParams{A: server.NewNumber(1)}, wantCode: server.RPCDivisionByZero},
+		{name: "Unknown method", method: "multiply", params: server.DivideParams{A: server.NewNumber(1), B: server.NewNumber(2)}, wantCode: server.RPCMethodNotFound},
+		{name: "Invalid params", method: "fizzbuzz", params: []int{1, 2}, wantCode: server.RPCInvalidParams},
+		{name: "Range too large", method: "classifyRange", params: server.ClassifyRangeParams{From: 1, To: 1000000}, wantCode: server.RPCInvalidParams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result any
+			err := rpc.Call(tt.method, tt.params, &result)
+
+			var rpcErr *server.RPCError
+			if !errors.As(err, &rpcErr) {
+				t.Fatalf("Call() error = %v, want an *server.RPCError", err)
+			}
+			if rpcErr.Code != tt.wantCode {
+				t.Errorf("Call() error code = %d, want %d", rpcErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRPC_Call_HTTPError(t *testing.T) {
+	// Without an API key the server rejects the request before it reaches the JSON-RPC handler.
+	rpc := newTestRPC(t, WithServerOptions(server.WithCredentials(server.Credential{Key: "key"})))
+
+	err := rpc.Call("fizzbuzz", server.FizzBuzzParams{N: 3}, &server.FizzBuzzResult{})
+	if err == nil || err.Error() != "401 Unauthorized: Missing API key" {
+		t.Errorf("Call() error = %v, want a 401 error", err)
+	}
+}
+
+func TestRPC_Credentials(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret []byte
+	}{
+		{name: "API key"},
+		{name: "Signed", secret: []byte("secret")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rpc := newTestRPC(t, WithCredentials("key", tt.secret))
+
+			var result server.FizzBuzzResult
+			if err := rpc.Call("fizzbuzz", server.FizzBuzzParams{N: 15}, &result); err != nil {
+				t.Fatalf("Call() error: %v", err)
+			}
+			if result.Output != "FizzBuzz" {
+				t.Errorf("Call() output = %q, want %q", result.Output, "FizzBuzz")
+			}
+		})
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 type FizzBuzz struct {
 	upperLimit int
-	repo       repository.FizzBuzzer
+	repo       repository.ContextFizzBuzzer
 }
 
 type result struct {
@@ -20,16 +20,22 @@ type result struct {
 	Buzz   bool
 }
 
+// New returns an engine using the repository. Repositories which implement
+// repository.ContextFizzBuzzer are called through it, so their calls can be cancelled.
 func New(upperLimit int, repo repository.FizzBuzzer) *FizzBuzz {
 	return &FizzBuzz{
 		upperLimit: upperLimit,
-		repo:       repo,
+		repo:       repository.WithContext(repo),
 	}
 }
 
-func (fb FizzBuzz) Run(ctx context.Context) {
+// Run works out FizzBuzz for every number up to the upper limit, logging the results.
+// If the repository fails, for example because it's unavailable, or the context is done, the run
+// stops before logging any result which might be wrong, and the error is returned.
+func (fb FizzBuzz) Run(ctx context.Context) error {
 
 	wg := sync.WaitGroup{}
+	var runErr error
 
 	// The Channel buffer is limited to half the upper limit, to exercise the channel's blocking behavior.
 	// This also ensures that the channel does not grow indefinitely if upperLimit is set to a very large number.
@@ -39,11 +45,12 @@ func (fb FizzBuzz) Run(ctx context.Context) {
 	go func() {
 		defer close(chProcessor)
 		for i := 1; i <= fb.upperLimit; i++ { // Fixed range loop to iterate correctly from 1 to upperLimit
-			chProcessor <- result{
-				Number: i,
-				Fizz:   fb.repo.Fizz(i),
-				Buzz:   fb.repo.Buzz(i),
+			r, err := fb.classify(ctx, i)
+			if err != nil {
+				runErr = fmt.Errorf("stopped at number %d: %w", i, err)
+				return
 			}
+			chProcessor <- r
 		}
 	}()
 
@@ -73,5 +80,20 @@ func (fb FizzBuzz) Run(ctx context.Context) {
 		}
 	}()
 
+	// The processor only finishes once the generator has closed the channel, so runErr is set.
 	wg.Wait()
+	return runErr
+}
+
+// classify asks the repository whether a number is Fizz and Buzz.
+func (fb FizzBuzz) classify(ctx context.Context, n int) (result, error) {
+	fizz, err := fb.repo.FizzContext(ctx, n)
+	if err != nil {
+		return result{}, err
+	}
+	buzz, err := fb.repo.BuzzContext(ctx, n)
+	if err != nil {
+		return result{}, err
+	}
+	return result{Number: n, Fizz: fizz, Buzz: buzz}, nil
 }
@@ -2,8 +2,11 @@ package app
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
+
+	"github.com/MarkSonghurstPersonal/fizzbuzz-golang/pkg/repository"
 )
 
 // mockFizzBuzzer is a mock implementation of the FizzBuzzer interface.
@@ -48,7 +51,9 @@ func TestRun(t *testing.T) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				fb.Run(context.Background())
+				if err := fb.Run(context.Background()); err != nil {
+					t.Errorf("Run() error: %v", err)
+				}
 			}()
 
 			// Wait for the Run function to complete
@@ -67,3 +72,78 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+// unavailableFizzBuzzer is a mock FizzBuzzer which becomes unavailable after answering for some numbers.
+type unavailableFizzBuzzer struct {
+	mockFizzBuzzer
+	mu        sync.Mutex
+	answered  int
+	available int // How many numbers it answers for before becoming unavailable.
+}
+
+func (m *unavailableFizzBuzzer) Buzz(n int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.answered = n
+	return m.mockFizzBuzzer.Buzz(n)
+}
+
+func (m *unavailableFizzBuzzer) Available() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.answered > m.available {
+		return repository.ErrUnavailable
+	}
+	return nil
+}
+
+func TestRun_Unavailable(t *testing.T) {
+	repo := &unavailableFizzBuzzer{available: 5}
+	fb := New(15, repo)
+
+	err := fb.Run(context.Background())
+	if !errors.Is(err, repository.ErrUnavailable) {
+		t.Fatalf("Expected an error wrapping repository.ErrUnavailable, got %v", err)
+	}
+	if expected := "stopped at number 6: fizzbuzzer unavailable"; err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+	if repo.answered != 6 {
+		t.Errorf("Expected the run to stop after number 6, got %d", repo.answered)
+	}
+}
+
+// contextFizzBuzzer is a mock ContextFizzBuzzer which fails for one number.
+type contextFizzBuzzer struct {
+	mockFizzBuzzer
+	failAt int
+}
+
+func (m contextFizzBuzzer) FizzContext(ctx context.Context, n int) (bool, error) {
+	if n == m.failAt {
+		return false, errors.New("divide service timed out")
+	}
+	return m.Fizz(n), nil
+}
+
+func (m contextFizzBuzzer) BuzzContext(ctx context.Context, n int) (bool, error) {
+	return m.Buzz(n), nil
+}
+
+func TestRun_ContextFizzBuzzer(t *testing.T) {
+	// The context-aware methods are preferred, so their error stops the run.
+	err := New(15, contextFizzBuzzer{failAt: 4}).Run(context.Background())
+	if expected := "stopped at number 4: divide service timed out"; err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := New(15, mockFizzBuzzer{}).Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancellation error, got %v", err)
+	}
+}
@@ -1,5 +1,14 @@
 package repository
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnavailable is returned, possibly wrapped, by implementations which can't currently give
+// correct answers, for example because a service they call is down.
+var ErrUnavailable = errors.New("fizzbuzzer unavailable")
+
 // FizzBuzzer is an interface for implementors of the super complicated FizzBuzz algorithm.
 type FizzBuzzer interface {
 	// Fizz checks if the given number is divisible by 3 and if so, return false.
@@ -7,3 +16,59 @@ type FizzBuzzer interface {
 	// Buzz checks if the given number is divisible by 5, and if so return true.
 	Buzz(int) bool
 }
+
+// ContextFizzBuzzer is a FizzBuzzer whose calls can be cancelled or given deadlines, and which
+// reports errors rather than giving an answer which may be wrong.
+type ContextFizzBuzzer interface {
+	// FizzContext checks if the given number is divisible by 3.
+	FizzContext(ctx context.Context, n int) (bool, error)
+	// BuzzContext checks if the given number is divisible by 5.
+	BuzzContext(ctx context.Context, n int) (bool, error)
+}
+
+// AvailabilityChecker is implemented by FizzBuzzers which can become unavailable.
+// Fizz and Buzz can't return errors, so callers check Available to find out whether their answers
+// can be trusted.
+type AvailabilityChecker interface {
+	// Available returns nil if the FizzBuzzer is answering correctly, otherwise an error wrapping
+	// ErrUnavailable.
+	Available() error
+}
+
+// WithContext returns fb as a ContextFizzBuzzer. If it already is one it's returned as it is.
+// Otherwise calls check the context before calling fb, and, if fb is an AvailabilityChecker,
+// return its error if it's unavailable after answering.
+func WithContext(fb FizzBuzzer) ContextFizzBuzzer {
+	if cfb, ok := fb.(ContextFizzBuzzer); ok {
+		return cfb
+	}
+	return contextShim{fb}
+}
+
+// contextShim adapts a FizzBuzzer to the ContextFizzBuzzer interface.
+type contextShim struct {
+	fb FizzBuzzer
+}
+
+// FizzContext implements the ContextFizzBuzzer interface.
+func (s contextShim) FizzContext(ctx context.Context, n int) (bool, error) {
+	return s.call(ctx, n, s.fb.Fizz)
+}
+
+// BuzzContext implements the ContextFizzBuzzer interface.
+func (s contextShim) BuzzContext(ctx context.Context, n int) (bool, error) {
+	return s.call(ctx, n, s.fb.Buzz)
+}
+
+func (s contextShim) call(ctx context.Context, n int, f func(int) bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	result := f(n)
+	if checker, ok := s.fb.(AvailabilityChecker); ok {
+		if err := checker.Available(); err != nil {
+			return false, err
+		}
+	}
+	return result, nil
+}